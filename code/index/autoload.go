@@ -0,0 +1,148 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAutoloadRoots returns the directories a Rails application
+// autoloads, relative to root: every directory under app except the ones
+// holding assets and views, their concerns directories, and lib.
+func DefaultAutoloadRoots(root string) []string {
+	var roots []string
+	entries, _ := os.ReadDir(filepath.Join(root, "app"))
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == "assets" || e.Name() == "javascript" || e.Name() == "views" {
+			continue
+		}
+		dir := filepath.Join("app", e.Name())
+		roots = append(roots, dir)
+		if info, err := os.Stat(filepath.Join(root, dir, "concerns")); err == nil && info.IsDir() {
+			roots = append(roots, filepath.Join(dir, "concerns"))
+		}
+	}
+	if info, err := os.Stat(filepath.Join(root, "lib")); err == nil && info.IsDir() {
+		roots = append(roots, "lib")
+	}
+	return roots
+}
+
+func (i *Index) autoloadRoots() []string {
+	if i.AutoloadRoots != nil {
+		return i.AutoloadRoots
+	}
+	return DefaultAutoloadRoots(i.Root)
+}
+
+// ExpectedConstant returns the constant Zeitwerk expects the file at path
+// to define, following the naming conventions of the innermost autoload
+// root containing it: app/models/billing/invoice.rb defines
+// Billing::Invoice.
+func (i *Index) ExpectedConstant(path string) (string, bool) {
+	if !strings.HasSuffix(path, ".rb") {
+		return "", false
+	}
+	rel, err := filepath.Rel(i.Root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	root := ""
+	for _, r := range i.autoloadRoots() {
+		r = filepath.Clean(r)
+		if strings.HasPrefix(rel, r+string(filepath.Separator)) && len(r) > len(root) {
+			root = r
+		}
+	}
+	if root == "" {
+		return "", false
+	}
+	rel = strings.TrimSuffix(strings.TrimPrefix(rel, root+string(filepath.Separator)), ".rb")
+	segments := strings.Split(rel, string(filepath.Separator))
+	for k, s := range segments {
+		segments[k] = camelize(s)
+	}
+	return strings.Join(segments, "::"), true
+}
+
+// camelize turns a file name into a constant name the way the default
+// inflector does, without custom inflections such as acronyms.
+func camelize(s string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(s, "_") {
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// AutoloadMismatch is a file under an autoload root that does not define
+// the constant its path maps to.
+type AutoloadMismatch struct {
+	Path     string
+	Expected string
+	Defined  []string
+}
+
+// CheckAutoload reports whether the file at path defines the constant its
+// path maps to. Files that declare no classes or modules are not checked.
+func (i *Index) CheckAutoload(path string) (AutoloadMismatch, bool) {
+	expected, ok := i.ExpectedConstant(path)
+	if !ok {
+		return AutoloadMismatch{}, false
+	}
+	defined := i.definedIn(path)
+	if len(defined) == 0 {
+		return AutoloadMismatch{}, false
+	}
+	for _, d := range defined {
+		if d == expected {
+			return AutoloadMismatch{}, false
+		}
+	}
+	return AutoloadMismatch{Path: path, Expected: expected, Defined: defined}, true
+}
+
+// definedIn returns the fully qualified names of the modules, classes and
+// constants declared in the file at path.
+func (i *Index) definedIn(path string) []string {
+	return i.table().defined[path]
+}
+
+// canonical reports whether n is declared in the file its name maps to,
+// which makes it the definition Rails would load.
+func (i *Index) canonical(n Node) bool {
+	var name string
+	switch d := n.(type) {
+	case *ClassDecl:
+		name = d.FullName()
+	case *ModuleDecl:
+		name = d.FullName()
+	case *ConstantDecl:
+		name = d.FullName()
+	default:
+		return false
+	}
+	expected, ok := i.ExpectedConstant(n.Range().Start.FileURI)
+	return ok && expected == name
+}
+
+// autoloadedFiles returns the files under an autoload root whose path maps
+// to a constant with the given unqualified name. Zeitwerk loads them even
+// when the declaration itself is not one the indexer understands.
+func (i *Index) autoloadedFiles(name string) []*Range {
+	var res []*Range
+	for _, path := range i.files {
+		expected, ok := i.ExpectedConstant(path)
+		if !ok {
+			continue
+		}
+		if _, short, _ := cutLast(expected, "::"); short == name {
+			loc := &Location{FileURI: path}
+			res = append(res, &Range{Start: loc, End: loc})
+		}
+	}
+	return res
+}
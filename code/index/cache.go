@@ -0,0 +1,106 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion must be bumped whenever the shape of cachedDecl or the
+// information extracted by the indexer changes.
+const cacheVersion = 4
+
+type cachedIndex struct {
+	Version int          `json:"version"`
+	Decls   []cachedDecl `json:"decls"`
+}
+
+type cachedDecl struct {
+	Type       NodeType     `json:"type"`
+	Name       string       `json:"name"`
+	Owner      string       `json:"owner,omitempty"`
+	Superclass string       `json:"superclass,omitempty"`
+	Includes   []string     `json:"includes,omitempty"`
+	Extends    []string     `json:"extends,omitempty"`
+	Singleton  bool         `json:"singleton,omitempty"`
+	Signature  string       `json:"signature,omitempty"`
+	Value      string       `json:"value,omitempty"`
+	Args       []string     `json:"args,omitempty"`
+	Types      []MethodType `json:"types,omitempty"`
+	Doc        *Doc         `json:"doc,omitempty"`
+	Range      *Range       `json:"range"`
+	Generator  *Range       `json:"generator,omitempty"`
+	Visibility Visibility   `json:"visibility,omitempty"`
+}
+
+// cachePath returns where the index of the gem installed in dir is cached.
+// Cached ranges hold absolute paths, so the same gem installed elsewhere,
+// as by another Ruby version, is cached apart.
+func cachePath(gem LockedGem, dir string) (string, bool) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Join(cache, "ruby-lsp", "gems", gem.DirName()+"-"+hex.EncodeToString(sum[:6])+".json"), true
+}
+
+func (i *Index) loadCached(gem LockedGem, dir string) bool {
+	path, ok := cachePath(gem, dir)
+	if !ok {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var cached cachedIndex
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Version != cacheVersion {
+		return false
+	}
+	for _, d := range cached.Decls {
+		switch d.Type {
+		case NodeModule:
+			i.ModuleDecls = append(i.ModuleDecls, ModuleDecl{Name: d.Name, Owner: d.Owner, Includes: d.Includes, Extends: d.Extends, Doc: d.Doc, r: d.Range})
+		case NodeClass:
+			i.ClassDecls = append(i.ClassDecls, ClassDecl{Name: d.Name, Owner: d.Owner, Superclass: d.Superclass, Includes: d.Includes, Extends: d.Extends, Doc: d.Doc, r: d.Range})
+		case NodeMethod:
+			i.MethodDecls = append(i.MethodDecls, MethodDecl{Name: d.Name, Owner: d.Owner, Singleton: d.Singleton, Signature: d.Signature, Args: d.Args, Types: d.Types, Doc: d.Doc, Generator: d.Generator, Visibility: d.Visibility, r: d.Range})
+		case NodeConstant:
+			i.ConstantDecls = append(i.ConstantDecls, ConstantDecl{Name: d.Name, Owner: d.Owner, Value: d.Value, Doc: d.Doc, r: d.Range})
+		}
+	}
+	return true
+}
+
+// storeCached writes the index to the gem cache. Failing to do so only costs
+// a reindex on the next start, so errors are ignored.
+func (i *Index) storeCached(gem LockedGem, dir string) {
+	path, ok := cachePath(gem, dir)
+	if !ok {
+		return
+	}
+	cached := cachedIndex{Version: cacheVersion}
+	for _, m := range i.ModuleDecls {
+		cached.Decls = append(cached.Decls, cachedDecl{Type: NodeModule, Name: m.Name, Owner: m.Owner, Includes: m.Includes, Extends: m.Extends, Doc: m.Doc, Range: m.r})
+	}
+	for _, c := range i.ClassDecls {
+		cached.Decls = append(cached.Decls, cachedDecl{Type: NodeClass, Name: c.Name, Owner: c.Owner, Superclass: c.Superclass, Includes: c.Includes, Extends: c.Extends, Doc: c.Doc, Range: c.r})
+	}
+	for _, m := range i.MethodDecls {
+		cached.Decls = append(cached.Decls, cachedDecl{Type: NodeMethod, Name: m.Name, Owner: m.Owner, Singleton: m.Singleton, Signature: m.Signature, Args: m.Args, Types: m.Types, Doc: m.Doc, Range: m.r, Generator: m.Generator, Visibility: m.Visibility})
+	}
+	for _, c := range i.ConstantDecls {
+		cached.Decls = append(cached.Decls, cachedDecl{Type: NodeConstant, Name: c.Name, Owner: c.Owner, Value: c.Value, Doc: c.Doc, Range: c.r})
+	}
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0o644)
+}
@@ -6,10 +6,22 @@ const (
 	NodeModule NodeType = iota
 	NodeClass
 	NodeMethod
+	NodeConstant
+	NodeVariable
+	NodeTask
 )
 
+type Node interface {
+	Range() *Range
+	Type() NodeType
+}
+
 type ModuleDecl struct {
 	Name        string
+	Owner       string
+	Includes    []string
+	Extends     []string
+	Doc         *Doc
 	r           *Range
 	ClassDecls  []*ClassDecl
 	ModuleDecls []*ModuleDecl
@@ -26,6 +38,10 @@ func (m *ModuleDecl) Type() NodeType {
 	return NodeModule
 }
 
+func (m *ModuleDecl) FullName() string {
+	return qualify(m.Owner, m.Name)
+}
+
 type Location struct {
 	Line      int
 	Character int
@@ -39,6 +55,11 @@ type Range struct {
 
 type ClassDecl struct {
 	Name        string
+	Owner       string
+	Superclass  string
+	Includes    []string
+	Extends     []string
+	Doc         *Doc
 	r           *Range
 	MethodDecls []*MethodDecl
 	ClassDecls  []*ClassDecl
@@ -55,10 +76,89 @@ func (c *ClassDecl) Type() NodeType {
 	return NodeClass
 }
 
+func (c *ClassDecl) FullName() string {
+	return qualify(c.Owner, c.Name)
+}
+
 type MethodDecl struct {
+	Name      string
+	Owner     string
+	Singleton bool
+	Signature string
+	Doc       *Doc
+	r         *Range
+	Args      []string
+	// Types holds the overloads declared for the method in signature files.
+	Types []MethodType
+	// Generator spans the call that defines a synthetic method, such as
+	// `Struct.new(:x, :y)`, `define_method` or `has_many`. It is nil for
+	// methods declared with def or in signatures.
+	Generator  *Range
+	Visibility Visibility
+}
+
+type Visibility int
+
+const (
+	Public Visibility = iota
+	Protected
+	Private
+)
+
+// Synthetic reports whether the method is generated by a call rather than
+// declared.
+func (m *MethodDecl) Synthetic() bool {
+	return m.Generator != nil
+}
+
+type MethodType struct {
+	// Text is the method type in RBS notation, e.g.
+	// `(Integer amount, ?String currency) -> Receipt`, with the types
+	// spelled the way the signature source spells them.
+	Text string
+	// Sig is the Sorbet `sig` block the type was read from, if any.
+	Sig    string
+	Params []TypedParam
+	Return string
+}
+
+type ParamKind int
+
+const (
+	ParamRequired ParamKind = iota
+	ParamOptional
+	ParamRest
+	ParamKeyword
+	ParamOptionalKeyword
+	ParamKeywordRest
+	ParamBlock
+)
+
+type TypedParam struct {
 	Name string
-	r    *Range
-	Args []string
+	Type string
+	Kind ParamKind
+}
+
+// Label renders the parameter the way it appears in the method type.
+func (p TypedParam) Label() string {
+	name := p.Name
+	switch p.Kind {
+	case ParamKeyword:
+		return name + ": " + p.Type
+	case ParamOptionalKeyword:
+		return "?" + name + ": " + p.Type
+	case ParamBlock:
+		if name == "" {
+			return p.Type
+		}
+		return "&" + p.Type + " " + name
+	}
+	prefix := map[ParamKind]string{ParamOptional: "?", ParamRest: "*", ParamKeywordRest: "**"}[p.Kind]
+	if name == "" {
+		return prefix + p.Type
+	}
+	return prefix + p.Type + " " + name
 }
 
 // Range implements Node.
@@ -70,3 +170,44 @@ func (m *MethodDecl) Range() *Range {
 func (m *MethodDecl) Type() NodeType {
 	return NodeMethod
 }
+
+// FullName returns the method name in Ruby's documentation notation, e.g.
+// Foo::Bar#baz for instance methods and Foo::Bar.baz for singleton methods.
+func (m *MethodDecl) FullName() string {
+	if m.Owner == "" {
+		return m.Name
+	}
+	if m.Singleton {
+		return m.Owner + "." + m.Name
+	}
+	return m.Owner + "#" + m.Name
+}
+
+type ConstantDecl struct {
+	Name  string
+	Owner string
+	Value string
+	Doc   *Doc
+	r     *Range
+}
+
+// Range implements Node.
+func (c *ConstantDecl) Range() *Range {
+	return c.r
+}
+
+// Type implements Node.
+func (c *ConstantDecl) Type() NodeType {
+	return NodeConstant
+}
+
+func (c *ConstantDecl) FullName() string {
+	return qualify(c.Owner, c.Name)
+}
+
+func qualify(owner, name string) string {
+	if owner == "" {
+		return name
+	}
+	return owner + "::" + name
+}
@@ -0,0 +1,30 @@
+package index
+
+import (
+	_ "embed"
+	"sync"
+)
+
+//go:embed core/core.rbs
+var coreRBS []byte
+
+var (
+	coreOnce  sync.Once
+	coreIndex *Index
+)
+
+// CorePath names the file of the declarations in Core. It is only
+// embedded in the server, so no file exists there to jump to.
+const CorePath = "core/core.rbs"
+
+// Core returns the index of the Ruby core and standard library signatures
+// bundled with the server. It is built once and shared, so callers must not
+// modify it.
+func Core() *Index {
+	coreOnce.Do(func() {
+		coreIndex = &Index{}
+		coreIndex.indexRBS(CorePath, coreRBS)
+		coreIndex.finish()
+	})
+	return coreIndex
+}
@@ -0,0 +1,283 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+type Doc struct {
+	Text       string
+	Params     []ParamTag
+	Return     *TypedTag
+	Raises     []TypedTag
+	Examples   []ExampleTag
+	Deprecated *string
+}
+
+type ParamTag struct {
+	Name  string
+	Types []string
+	Text  string
+}
+
+type TypedTag struct {
+	Types []string
+	Text  string
+}
+
+type ExampleTag struct {
+	Title string
+	Code  string
+}
+
+// commentMap holds the standalone `#` comments of a file keyed by the line
+// they appear on, so that the block directly above a declaration can be
+// collected.
+type commentMap struct {
+	lines map[int]string
+}
+
+func newCommentMap(src []byte, lines *LineIndex, result *parser.ParseResult) *commentMap {
+	cm := &commentMap{lines: make(map[int]string)}
+	for _, c := range result.Comments {
+		start := int(c.Loc.StartOffset)
+		end := int(c.Loc.EndOffset())
+		if start >= len(src) || end > len(src) {
+			continue
+		}
+		line := lines.Line(start)
+		if c.Typpe != 0 || !onlySpaceBefore(src, start) || isMagicComment(src, result, start, end) {
+			continue
+		}
+		cm.lines[line] = strings.TrimRight(strings.TrimPrefix(string(src[start:end]), "#"), "\r")
+	}
+	return cm
+}
+
+var magicCommentKeys = map[string]bool{
+	"coding":                   true,
+	"encoding":                 true,
+	"frozen_string_literal":    true,
+	"shareable_constant_value": true,
+	"typed":                    true,
+	"warn_indent":              true,
+}
+
+// isMagicComment reports whether the comment is a pragma such as
+// `# frozen_string_literal: true`. Prism flags any `key: value` comment, so
+// the key is checked against the pragmas Ruby and Sorbet understand.
+func isMagicComment(src []byte, result *parser.ParseResult, start, end int) bool {
+	for _, m := range result.MagicComments {
+		key := m.KeyLocation
+		if int(key.StartOffset) < start || int(key.EndOffset()) > end {
+			continue
+		}
+		name := strings.ReplaceAll(strings.ToLower(string(src[key.StartOffset:key.EndOffset()])), "-", "_")
+		if magicCommentKeys[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func onlySpaceBefore(src []byte, offset int) bool {
+	for i := offset - 1; i >= 0 && src[i] != '\n'; i-- {
+		if src[i] != ' ' && src[i] != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// docAbove returns the documentation for a declaration starting on line, or
+// nil when the line is not directly preceded by a comment block.
+func (cm *commentMap) docAbove(line int) *Doc {
+	if cm == nil {
+		return nil
+	}
+	var block []string
+	for l := line - 1; l >= 0; l-- {
+		text, ok := cm.lines[l]
+		if !ok {
+			break
+		}
+		block = append(block, text)
+	}
+	if len(block) == 0 {
+		return nil
+	}
+	for i, j := 0, len(block)-1; i < j; i, j = i+1, j-1 {
+		block[i], block[j] = block[j], block[i]
+	}
+	return parseDoc(block)
+}
+
+func parseDoc(lines []string) *Doc {
+	lines = dedent(lines)
+	doc := &Doc{}
+	var text []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if !strings.HasPrefix(line, "@") {
+			text = append(text, line)
+			continue
+		}
+		tag, rest, _ := strings.Cut(line[1:], " ")
+		var body []string
+		for i+1 < len(lines) && (lines[i+1] == "" || strings.HasPrefix(lines[i+1], " ")) {
+			i++
+			body = append(body, lines[i])
+		}
+		for len(body) > 0 && strings.TrimSpace(body[len(body)-1]) == "" {
+			body = body[:len(body)-1]
+		}
+		switch tag {
+		case "param":
+			doc.Params = append(doc.Params, parseParamTag(rest, body))
+		case "return":
+			types, desc := parseTypes(rest)
+			doc.Return = &TypedTag{Types: types, Text: joinText(desc, body)}
+		case "raise":
+			types, desc := parseTypes(rest)
+			doc.Raises = append(doc.Raises, TypedTag{Types: types, Text: joinText(desc, body)})
+		case "example":
+			doc.Examples = append(doc.Examples, ExampleTag{
+				Title: strings.TrimSpace(rest),
+				Code:  strings.Join(dedent(body), "\n"),
+			})
+		case "deprecated":
+			reason := joinText(rest, body)
+			doc.Deprecated = &reason
+		}
+	}
+	doc.Text = strings.TrimSpace(strings.Join(text, "\n"))
+	return doc
+}
+
+// parseParamTag accepts both YARD orderings, `@param name [Type] text` and
+// `@param [Type] name text`.
+func parseParamTag(rest string, body []string) ParamTag {
+	rest = strings.TrimSpace(rest)
+	var p ParamTag
+	if strings.HasPrefix(rest, "[") {
+		p.Types, rest = parseTypes(rest)
+		p.Name, rest, _ = strings.Cut(rest, " ")
+	} else {
+		p.Name, rest, _ = strings.Cut(rest, " ")
+		p.Types, rest = parseTypes(rest)
+	}
+	p.Text = joinText(rest, body)
+	return p
+}
+
+func parseTypes(s string) ([]string, string) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") {
+		return nil, s
+	}
+	end := strings.Index(s, "]")
+	if end < 0 {
+		return nil, s
+	}
+	var types []string
+	for _, t := range strings.Split(s[1:end], ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types, strings.TrimSpace(s[end+1:])
+}
+
+func joinText(first string, rest []string) string {
+	parts := []string{strings.TrimSpace(first)}
+	for _, l := range rest {
+		parts = append(parts, strings.TrimSpace(l))
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+func dedent(lines []string) []string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " "))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			l = l[indent:]
+		}
+		out[i] = strings.TrimRight(l, " ")
+	}
+	return out
+}
+
+func (d *Doc) Markdown() string {
+	if d == nil {
+		return ""
+	}
+	var b strings.Builder
+	section := func() {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+	}
+	if d.Deprecated != nil {
+		section()
+		b.WriteString("**Deprecated**")
+		if *d.Deprecated != "" {
+			b.WriteString(" " + *d.Deprecated)
+		}
+	}
+	if d.Text != "" {
+		section()
+		b.WriteString(d.Text)
+	}
+	if len(d.Params) > 0 {
+		section()
+		b.WriteString("**Parameters**\n")
+		for _, p := range d.Params {
+			b.WriteString("\n- `" + p.Name + "`" + typeList(p.Types) + dash(p.Text))
+		}
+	}
+	if d.Return != nil {
+		section()
+		b.WriteString("**Returns**" + typeList(d.Return.Types) + dash(d.Return.Text))
+	}
+	if len(d.Raises) > 0 {
+		section()
+		b.WriteString("**Raises**\n")
+		for _, r := range d.Raises {
+			b.WriteString("\n-" + typeList(r.Types) + dash(r.Text))
+		}
+	}
+	for _, e := range d.Examples {
+		section()
+		b.WriteString("**Example**")
+		if e.Title != "" {
+			b.WriteString(" " + e.Title)
+		}
+		b.WriteString("\n\n```ruby\n" + e.Code + "\n```")
+	}
+	return b.String()
+}
+
+func typeList(types []string) string {
+	if len(types) == 0 {
+		return ""
+	}
+	return " `" + strings.Join(types, ", ") + "`"
+}
+
+func dash(text string) string {
+	if text == "" {
+		return ""
+	}
+	return " — " + text
+}
@@ -0,0 +1,285 @@
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultExclude is used when no exclude patterns are configured. Vendored
+// gems are indexed from the Gemfile.lock instead.
+var DefaultExclude = []string{"**/.*/", "**/node_modules/", "**/npm-workspaces/", "**/vendor/"}
+
+// FileKind is how the indexer reads a file.
+type FileKind int
+
+const (
+	FileIgnored FileKind = iota
+	FileRuby
+	FileRBS
+	FileRBI
+	// FileStructureSQL is db/structure.sql, read for its table columns.
+	FileStructureSQL
+)
+
+var rubyFileNames = map[string]bool{
+	"Gemfile":     true,
+	"Rakefile":    true,
+	"Guardfile":   true,
+	"Capfile":     true,
+	"Brewfile":    true,
+	"Podfile":     true,
+	"Vagrantfile": true,
+}
+
+var rubyExtensions = map[string]bool{
+	".rb":      true,
+	".rake":    true,
+	".gemspec": true,
+	".ru":      true,
+}
+
+// fileKind tells Ruby sources apart by name, falling back to the shebang
+// line for executables without an extension.
+func fileKind(path string) FileKind {
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	switch {
+	case ext == ".rbs":
+		return FileRBS
+	case ext == ".rbi":
+		return FileRBI
+	case name == "structure.sql" && filepath.Base(filepath.Dir(path)) == "db":
+		return FileStructureSQL
+	case rubyExtensions[ext], rubyFileNames[name]:
+		return FileRuby
+	case ext == "" && hasRubyShebang(path):
+		return FileRuby
+	}
+	return FileIgnored
+}
+
+func hasRubyShebang(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	return strings.HasPrefix(line, "#!") && strings.Contains(line, "ruby")
+}
+
+// ignoreRule is a single line of a .gitignore file.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	source  string
+}
+
+// fileFilter decides which files under root are indexed, from the include
+// and exclude globs and the git ignore files found on the way down.
+type fileFilter struct {
+	root    string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	globs   []string
+	ignores map[string][]ignoreRule
+}
+
+func newFileFilter(root string, include, exclude []string) *fileFilter {
+	if exclude == nil {
+		exclude = DefaultExclude
+	}
+	f := &fileFilter{root: root, ignores: make(map[string][]ignoreRule)}
+	for _, g := range include {
+		f.include = append(f.include, globRegexp(strings.TrimSuffix(g, "/"), true))
+	}
+	for _, g := range exclude {
+		f.exclude = append(f.exclude, globRegexp(strings.TrimSuffix(g, "/"), true))
+		f.globs = append(f.globs, g)
+	}
+	// .git/info/exclude applies at the root, below the .gitignore there.
+	f.ignores["."] = append(readIgnoreFile(filepath.Join(root, ".git", "info", "exclude"), "."),
+		readIgnoreFile(filepath.Join(root, ".gitignore"), ".")...)
+	return f
+}
+
+// skip returns why the file or directory at rel, relative to the root,
+// should not be indexed, or "" if it should.
+func (f *fileFilter) skip(rel string, dir bool) string {
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return ""
+	}
+	if filepath.Base(rel) == ".git" {
+		return "git metadata"
+	}
+	for k, re := range f.exclude {
+		if strings.HasSuffix(f.globs[k], "/") && !dir {
+			continue
+		}
+		if re.MatchString(rel) {
+			return fmt.Sprintf("excluded by pattern %q", f.globs[k])
+		}
+	}
+	if rule, ok := f.ignored(rel, dir); ok {
+		return "ignored by " + rule.source
+	}
+	if !dir && len(f.include) > 0 {
+		included := false
+		for _, re := range f.include {
+			included = included || re.MatchString(rel)
+		}
+		if !included {
+			return "not matched by the include patterns"
+		}
+	}
+	return ""
+}
+
+// ignored applies the ignore files of every directory above rel, deepest
+// last, so later rules override earlier ones as in git.
+func (f *fileFilter) ignored(rel string, dir bool) (ignoreRule, bool) {
+	var match ignoreRule
+	matched := false
+	parts := strings.Split(rel, "/")
+	for k := 0; k < len(parts); k++ {
+		base := "."
+		if k > 0 {
+			base = strings.Join(parts[:k], "/")
+		}
+		rules, ok := f.ignores[base]
+		if !ok {
+			rules = readIgnoreFile(filepath.Join(f.root, filepath.FromSlash(base), ".gitignore"), base)
+			f.ignores[base] = rules
+		}
+		sub := strings.Join(parts[k:], "/")
+		for _, r := range rules {
+			if r.dirOnly && !dir {
+				continue
+			}
+			if r.pattern.MatchString(sub) {
+				match, matched = r, !r.negate
+			}
+		}
+	}
+	return match, matched
+}
+
+func readIgnoreFile(path, base string) []ignoreRule {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	name := filepath.ToSlash(filepath.Join(base, filepath.Base(path)))
+	if strings.HasSuffix(path, filepath.Join(".git", "info", "exclude")) {
+		name = ".git/info/exclude"
+	}
+	var rules []ignoreRule
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " ")
+		rule := ignoreRule{source: fmt.Sprintf("%s:%d (%s)", name, n+1, line)}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// A slash anywhere but the end anchors the pattern to the
+		// directory of the ignore file.
+		anchored := strings.Contains(line, "/")
+		rule.pattern = globRegexp(strings.TrimPrefix(line, "/"), anchored)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// globRegexp compiles a gitignore style glob. Unanchored patterns match at
+// any depth.
+func globRegexp(glob string, anchored bool) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for k := 0; k < len(glob); k++ {
+		c := glob[k]
+		switch {
+		case strings.HasPrefix(glob[k:], "**/"):
+			b.WriteString("(?:.*/)?")
+			k += 2
+		case strings.HasPrefix(glob[k:], "**"):
+			b.WriteString(".*")
+			k++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[k:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[k+1 : k+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			k += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return regexp.MustCompile("^" + regexp.QuoteMeta(glob) + "$")
+	}
+	return re
+}
+
+// ExplainFile says whether the file at path is indexed and why.
+func (i *Index) ExplainFile(path string) (bool, string) {
+	rel, err := filepath.Rel(i.Root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false, "outside the workspace"
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, "does not exist"
+	}
+	f := newFileFilter(i.Root, i.Include, i.Exclude)
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for k := 1; k <= len(parts); k++ {
+		dir := k < len(parts) || info.IsDir()
+		if reason := f.skip(strings.Join(parts[:k], "/"), dir); reason != "" {
+			if k < len(parts) {
+				return false, fmt.Sprintf("directory %s %s", strings.Join(parts[:k], "/"), reason)
+			}
+			return false, reason
+		}
+	}
+	switch fileKind(path) {
+	case FileRuby:
+		return true, "indexed as Ruby source"
+	case FileRBS:
+		return true, "indexed as RBS signatures"
+	case FileRBI:
+		return true, "indexed as RBI signatures"
+	case FileStructureSQL:
+		return true, "indexed for its table columns"
+	}
+	return false, "not a Ruby file"
+}
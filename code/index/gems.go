@@ -0,0 +1,250 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+type GemSource int
+
+const (
+	GemSourceRubygems GemSource = iota
+	GemSourceGit
+	GemSourcePath
+)
+
+type LockedGem struct {
+	Name    string
+	Version string
+	Source  GemSource
+	// Remote is the path of a PATH gem or the checked out revision of a
+	// GIT gem.
+	Remote string
+}
+
+// DirName is the directory name bundler and rubygems install the gem under.
+func (g LockedGem) DirName() string {
+	if g.Source == GemSourceGit {
+		rev := g.Remote
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		return g.Name + "-" + rev
+	}
+	return g.Name + "-" + g.Version
+}
+
+// ParseGemfileLock returns the gems listed in the specs of every source
+// section of a Gemfile.lock. Transitive dependencies, which bundler lists
+// with deeper indentation, are skipped because they appear as specs too.
+func ParseGemfileLock(data []byte) []LockedGem {
+	var gems []LockedGem
+	var source GemSource
+	var remote, revision string
+	inSpecs := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			inSpecs = false
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			inSpecs = false
+			remote, revision = "", ""
+			switch line {
+			case "GEM":
+				source = GemSourceRubygems
+			case "GIT":
+				source = GemSourceGit
+			case "PATH":
+				source = GemSourcePath
+			default:
+				source = -1
+			}
+			continue
+		}
+		if source < 0 {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "  remote: "):
+			remote = strings.TrimPrefix(trimmed, "remote: ")
+		case strings.HasPrefix(line, "  revision: "):
+			revision = strings.TrimPrefix(trimmed, "revision: ")
+		case line == "  specs:":
+			inSpecs = true
+		case inSpecs && strings.HasPrefix(line, "    ") && !strings.HasPrefix(line, "     "):
+			name, version, ok := strings.Cut(trimmed, " ")
+			if !ok {
+				continue
+			}
+			gem := LockedGem{
+				Name:    name,
+				Version: strings.Trim(version, "()"),
+				Source:  source,
+			}
+			switch source {
+			case GemSourceGit:
+				gem.Remote = revision
+			case GemSourcePath:
+				gem.Remote = remote
+			}
+			gems = append(gems, gem)
+		}
+	}
+	return gems
+}
+
+// gemDirs returns the directories gems may be installed in for the
+// workspace at root, most specific first: the bundler path configured in
+// the environment or .bundle/config, vendor/bundle, then GEM_HOME,
+// GEM_PATH and the usual per-user and version manager locations.
+func gemDirs(root string) []string {
+	var bases []string
+	if p := os.Getenv("BUNDLE_PATH"); p != "" {
+		bases = append(bases, bundlePath(root, p))
+	}
+	if p := bundleConfig(filepath.Join(root, ".bundle", "config"), "BUNDLE_PATH"); p != "" {
+		bases = append(bases, bundlePath(root, p))
+	}
+	bases = append(bases, filepath.Join(root, "vendor", "bundle"))
+	if p := os.Getenv("GEM_HOME"); p != "" {
+		bases = append(bases, p)
+	}
+	bases = append(bases, filepath.SplitList(os.Getenv("GEM_PATH"))...)
+	if home, err := os.UserHomeDir(); err == nil {
+		for _, pattern := range []string{
+			".gem/ruby/*",
+			".local/share/gem/ruby/*",
+			".rbenv/versions/*/lib/ruby/gems/*",
+			".rubies/*/lib/ruby/gems/*",
+			".asdf/installs/ruby/*/lib/ruby/gems/*",
+		} {
+			matches, _ := filepath.Glob(filepath.Join(home, pattern))
+			bases = append(bases, matches...)
+		}
+	}
+	for _, pattern := range []string{"/usr/local/lib/ruby/gems/*", "/var/lib/gems/*", "/usr/lib/ruby/gems/*"} {
+		matches, _ := filepath.Glob(pattern)
+		bases = append(bases, matches...)
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, base := range bases {
+		// Bundler nests installs under ruby/<abi version>, rubygems does not.
+		candidates, _ := filepath.Glob(filepath.Join(base, "ruby", "*"))
+		candidates = append(candidates, base)
+		for _, c := range candidates {
+			for _, sub := range []string{"gems", filepath.Join("bundler", "gems")} {
+				dir := filepath.Join(c, sub)
+				if seen[dir] {
+					continue
+				}
+				seen[dir] = true
+				if info, err := os.Stat(dir); err == nil && info.IsDir() {
+					dirs = append(dirs, dir)
+				}
+			}
+		}
+	}
+	return dirs
+}
+
+func bundlePath(root, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(root, p)
+}
+
+// bundleConfig reads a single key from bundler's YAML config file.
+func bundleConfig(path, key string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.Trim(strings.TrimSpace(v), `"'`)
+		}
+	}
+	return ""
+}
+
+func locateGem(root string, gem LockedGem, dirs []string) (string, bool) {
+	if gem.Source == GemSourcePath {
+		dir := bundlePath(root, gem.Remote)
+		if rel, err := filepath.Rel(root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			// Already part of the workspace.
+			return "", false
+		}
+		info, err := os.Stat(dir)
+		return dir, err == nil && info.IsDir()
+	}
+	for _, d := range dirs {
+		dir := filepath.Join(d, gem.DirName())
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// indexGems indexes the sources of every gem in the Gemfile.lock at i.Root.
+// Gems are immutable for a given version, so each one is read from the
+// on-disk cache when it has been indexed before.
+func (i *Index) indexGems(p *parser.Parser, logger *log.Logger) {
+	data, err := os.ReadFile(filepath.Join(i.Root, "Gemfile.lock"))
+	if err != nil {
+		data, err = os.ReadFile(filepath.Join(i.Root, "gems.locked"))
+	}
+	if err != nil {
+		i.finish()
+		return
+	}
+	logger.Println("started indexing gems")
+	dirs := gemDirs(i.Root)
+	for _, gem := range ParseGemfileLock(data) {
+		dir, ok := locateGem(i.Root, gem, dirs)
+		if !ok {
+			logger.Printf("gem %s (%s) not found", gem.Name, gem.Version)
+			continue
+		}
+		src := dir
+		if info, err := os.Stat(filepath.Join(dir, "lib")); err == nil && info.IsDir() {
+			src = filepath.Join(dir, "lib")
+		}
+		i.LoadPath = append(i.LoadPath, src)
+		if gem.Source != GemSourcePath && i.loadCached(gem, dir) {
+			continue
+		}
+		gemIndex := &Index{Root: dir}
+		if err := gemIndex.indexDir(p, src); err != nil {
+			logger.Printf("failed to index gem %s: %s", gem.Name, err)
+			continue
+		}
+		if gem.Source != GemSourcePath {
+			gemIndex.storeCached(gem, dir)
+		}
+		i.merge(gemIndex)
+	}
+	logger.Println("indexing gems finished")
+	i.finish()
+}
+
+func (i *Index) merge(other *Index) {
+	i.ModuleDecls = append(i.ModuleDecls, other.ModuleDecls...)
+	i.ClassDecls = append(i.ClassDecls, other.ClassDecls...)
+	i.MethodDecls = append(i.MethodDecls, other.MethodDecls...)
+	i.ConstantDecls = append(i.ConstantDecls, other.ConstantDecls...)
+}
@@ -2,22 +2,69 @@ package index
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/tjgurwara99/go-ruby-prism/parser"
 )
 
+// Index holds the declarations found under Root. It is built by Start and
+// must not be modified once it is shared; Workspace publishes indexes as
+// snapshots.
 type Index struct {
-	Root        string
-	Indexed     bool
-	ClassDecls  []ClassDecl
-	ModuleDecls []ModuleDecl
-	MethodDecls []MethodDecl
+	Root          string
+	Indexed       bool
+	ClassDecls    []ClassDecl
+	ModuleDecls   []ModuleDecl
+	MethodDecls   []MethodDecl
+	ConstantDecls []ConstantDecl
+	// Generation counts the snapshots published by a Workspace.
+	Generation int
+	// Dependencies holds the declarations of the gems locked in the
+	// workspace's Gemfile.lock. It is searched after the workspace itself.
+	Dependencies *Index
+	// Builtins holds the bundled core and standard library declarations,
+	// searched last.
+	Builtins *Index
+	// AutoloadRoots are the directories, relative to Root, whose files
+	// follow Zeitwerk naming. Start fills in the Rails defaults when unset.
+	AutoloadRoots []string
+	// Include and Exclude are glob patterns relative to Root. Files must
+	// match an include pattern when there are any; Exclude defaults to
+	// DefaultExclude.
+	Include []string
+	Exclude []string
+	// LoadPath approximates $LOAD_PATH: the directories require searches,
+	// relative to Root unless absolute. Start defaults it to
+	// DefaultLoadPath and the Dependencies index holds the gems' lib
+	// directories.
+	LoadPath []string
+	// Problems lists the files that failed to index, fully or in part.
+	Problems []FileProblem
+	// References holds the constant reads, method calls and symbol
+	// arguments found in the indexed files.
+	References []Reference
+	// VariableDecls holds the instance and class variable assignments in
+	// the indexed files.
+	VariableDecls []VariableDecl
+	// Requires holds the require, require_relative, load and autoload
+	// calls in the indexed files.
+	Requires []Require
+	// SharedGroups holds the RSpec shared_examples and shared_context
+	// definitions in the indexed files.
+	SharedGroups []SharedGroup
+	// Tasks holds the Rake tasks and rules in the indexed files.
+	Tasks []RakeTask
+
+	signatures *Index
+	files      []string
+	symbols    *symbolTable
 }
 
 func New(path string) *Index {
@@ -31,183 +78,715 @@ func (i *Index) Start(logger *log.Logger) error {
 	if err != nil {
 		return err
 	}
+	if i.AutoloadRoots == nil {
+		i.AutoloadRoots = DefaultAutoloadRoots(i.Root)
+	}
+	if i.LoadPath == nil {
+		i.LoadPath = DefaultLoadPath
+	}
 	logger.Println("started indexing")
-	err = filepath.Walk(i.Root, func(path string, info fs.FileInfo, err error) error {
-		if info.IsDir() && (strings.HasPrefix(info.Name(), ".") ||
-			info.Name() == "node_modules" || info.Name() == "npm-workspaces" ||
-			info.Name() == "vendor") {
-			return filepath.SkipDir
-		}
-		if err == nil && strings.HasSuffix(info.Name(), ".rb") {
-			src, err := os.ReadFile(path)
-			if err != nil {
-				return err
+	if err := i.indexDir(p, i.Root); err != nil {
+		i.problem(i.Root, err)
+	}
+	logger.Printf("indexing finished: %d files, %d problems", len(i.files), len(i.Problems))
+	i.finish()
+	i.Dependencies = &Index{Root: i.Root}
+	i.Dependencies.indexGems(p, logger)
+	return nil
+}
+
+func (i *Index) indexDir(p *parser.Parser, dir string) error {
+	defer i.mergeSignatures()
+	filter := newFileFilter(dir, i.Include, i.Exclude)
+	return filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			i.problem(path, err)
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if filter.skip(rel, info.IsDir()) != "" {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
-			result, err := p.Parse(context.Background(), src)
-			if err != nil {
-				return err
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		switch fileKind(path) {
+		case FileRuby:
+			i.files = append(i.files, path)
+			i.indexFile(p, path)
+		case FileRBS:
+			if err := i.indexRBSFile(path); err != nil {
+				i.problem(path, err)
+			}
+		case FileRBI:
+			// RBI files only declare, their definitions live elsewhere.
+			// Their problems are reported here.
+			sigs := i.signatureIndex()
+			sigs.indexFile(p, path)
+			i.Problems = append(i.Problems, sigs.Problems...)
+			sigs.Problems = nil
+		case FileStructureSQL:
+			if err := i.indexStructureSQL(path); err != nil {
+				i.problem(path, err)
 			}
-			i.indexProgram(result.Value, path, src)
 		}
 		return nil
 	})
+}
+
+// indexFile indexes what it can of the file at path and records a
+// problem when the file cannot be read, has syntax errors or contains
+// declarations the indexer fails on. Prism recovers from syntax errors, so
+// the valid parts of a broken file are still indexed.
+func (i *Index) indexFile(p *parser.Parser, path string) {
+	src, err := os.ReadFile(path)
 	if err != nil {
-		logger.Fatal("indexing failed")
+		i.problem(path, err)
+		return
 	}
-	logger.Println("indexing finished")
-	i.Indexed = true
-	return nil
+	result, err := p.Parse(context.Background(), src)
+	if err != nil {
+		i.problem(path, err)
+		return
+	}
+	lines := NewLineIndex(src)
+	file := &sourceFile{
+		path:     path,
+		src:      src,
+		lines:    lines,
+		comments: newCommentMap(src, lines, result),
+	}
+	if len(result.SynError) > 0 {
+		e := result.SynError[0]
+		line := lines.Line(int(e.Location.StartOffset))
+		i.Problems = append(i.Problems, FileProblem{Path: path, Line: line, Message: "syntax error: " + e.Message, Partial: true})
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			i.Problems = append(i.Problems, FileProblem{Path: path, Message: fmt.Sprintf("indexer panic: %v", r), Partial: true})
+		}
+	}()
+	if err := i.indexProgram(result.Value, file, scope{}); err != nil {
+		i.Problems = append(i.Problems, FileProblem{Path: path, Message: err.Error(), Partial: true})
+	}
+	i.indexReferences(result.Value, file, refScope{})
+	if isSchema(path) {
+		i.indexSchema(result.Value, file)
+	}
+	if IsRakeFile(path) {
+		i.indexRake(result.Value, file, "")
+	}
+}
+
+// FileProblem is a file that could not be indexed, or only in part.
+type FileProblem struct {
+	Path    string
+	Line    int
+	Message string
+	// Partial is set when the declarations before and around the problem
+	// were still indexed.
+	Partial bool
+}
+
+func (i *Index) problem(path string, err error) {
+	i.Problems = append(i.Problems, FileProblem{Path: path, Message: err.Error()})
+}
+
+// FileCount is the number of Ruby files indexed.
+func (i *Index) FileCount() int {
+	return len(i.files)
+}
+
+type sourceFile struct {
+	path     string
+	src      []byte
+	lines    *LineIndex
+	comments *commentMap
+}
+
+// scope is the lexical context a declaration is indexed in: the fully
+// qualified name of the enclosing class or module and whether definitions
+// land on its singleton class (inside `class << self`).
+type scope struct {
+	namespace string
+	singleton bool
+	// mixin records an include (or extend) on the enclosing declaration.
+	mixin func(name string, extend bool)
+	// visibility applies to the methods defined with def, as set by a
+	// bare `private` or `protected` earlier in the body.
+	visibility Visibility
 }
 
-func (i *Index) indexProgram(node parser.Node, path string, src []byte) error {
+func (i *Index) indexProgram(node parser.Node, file *sourceFile, sc scope) error {
 	if node == nil {
 		return nil
 	}
+	// A declaration that cannot be indexed does not stop its siblings.
+	var errs []error
+	var sig *sorbetSig
+	first := len(i.MethodDecls)
+	named := make(map[string]Visibility)
 	for _, child := range node.Children() {
+		if s, ok := parseSorbetSig(child, file.src); ok {
+			sig = s
+			continue
+		}
+		pending := sig
+		sig = nil
 		switch n := child.(type) {
 		case *parser.ModuleNode:
-			err := i.indexModule(n, path, src)
-			if err != nil {
-				return err
-			}
+			errs = append(errs, i.indexModule(n, file, sc))
 		case *parser.ClassNode:
-			err := i.indexClass(n, path, src)
-			if err != nil {
-				return err
+			errs = append(errs, i.indexClass(n, file, sc))
+		case *parser.SingletonClassNode:
+			if _, ok := n.Expression.(*parser.SelfNode); !ok {
+				continue
 			}
+			errs = append(errs, i.indexProgram(n.Body, file, scope{namespace: sc.namespace, singleton: true, mixin: sc.mixin}))
 		case *parser.DefNode:
-			err := i.indexMethod(n, path, src)
-			if err != nil {
-				return err
+			errs = append(errs, i.indexMethod(n, file, sc, pending))
+		case *parser.ConstantWriteNode:
+			errs = append(errs, i.indexConstant(n, file, sc))
+		case *parser.CallNode:
+			if v, ok := visibilityCall(n); ok {
+				errs = append(errs, i.indexVisibility(n, v, file, &sc, named, pending))
+				continue
 			}
+			errs = append(errs, i.indexCall(n, file, sc, pending))
 		case *parser.StatementsNode:
-			err := i.indexProgram(n, path, src)
-			if err != nil {
+			errs = append(errs, i.indexProgram(n, file, sc))
+		}
+	}
+	// `private :name` applies to methods defined anywhere in the body.
+	for k := first; k < len(i.MethodDecls) && len(named) > 0; k++ {
+		m := &i.MethodDecls[k]
+		if v, ok := named[m.Name]; ok && m.Owner == sc.namespace && m.Singleton == sc.singleton {
+			m.Visibility = v
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var visibilities = map[string]Visibility{
+	"public":    Public,
+	"protected": Protected,
+	"private":   Private,
+}
+
+func visibilityCall(n *parser.CallNode) (Visibility, bool) {
+	if n.Receiver != nil || n.Block != nil {
+		return Public, false
+	}
+	v, ok := visibilities[n.Name]
+	return v, ok
+}
+
+// indexVisibility handles `private` on its own, which applies to the defs
+// after it, around a def, and with method names.
+func (i *Index) indexVisibility(n *parser.CallNode, v Visibility, file *sourceFile, sc *scope, named map[string]Visibility, sig *sorbetSig) error {
+	if n.Arguments == nil {
+		sc.visibility = v
+		return nil
+	}
+	for _, arg := range n.Arguments.Arguments {
+		switch a := arg.(type) {
+		case *parser.DefNode:
+			inner := *sc
+			inner.visibility = v
+			if err := i.indexMethod(a, file, inner, sig); err != nil {
 				return err
 			}
+		case *parser.SymbolNode:
+			named[a.Unescaped] = v
+		case *parser.StringNode:
+			named[a.Unescaped] = v
 		}
 	}
 	return nil
 }
 
-func locationFromOffset(src []byte, path string, offset int) (*Location, error) {
-	if offset < 0 || offset >= len(src) {
+// location converts a byte offset into a location. The offset just past
+// the last byte is valid: it is where declarations closed by the end of
+// the file end.
+func (f *sourceFile) location(offset int) (*Location, error) {
+	if offset < 0 || offset > len(f.src) {
 		return nil, fmt.Errorf("fileOffset is out of bounds")
 	}
-
-	line := 0
-	lineOffset := 0
-
-	for i := 0; i < offset; i++ {
-		if src[i] == '\n' {
-			line++
-			lineOffset = 0
-		} else {
-			lineOffset++
-		}
-	}
+	line, character := f.lines.Position(offset)
 	return &Location{
 		Line:      line,
-		Character: lineOffset,
-		FileURI:   path,
+		Character: character,
+		FileURI:   f.path,
 	}, nil
 }
 
-func (i *Index) indexModule(node *parser.ModuleNode, path string, src []byte) error {
-	startLocation, err := locationFromOffset(src, path, int(node.Modulekeywordloc.StartOffset))
+func constantPath(node parser.Node) string {
+	switch n := node.(type) {
+	case *parser.ConstantReadNode:
+		return n.Name
+	case *parser.ConstantPathNode:
+		child := constantPath(n.Child)
+		if n.Parent == nil {
+			return "::" + child
+		}
+		return constantPath(n.Parent) + "::" + child
+	}
+	return ""
+}
+
+// declOwner returns the namespace a class or module declared through path
+// belongs to, taking explicit `Foo::Bar` and `::Bar` paths into account.
+func declOwner(sc scope, path parser.Node) string {
+	owner, _, ok := cutLast(declName(sc.namespace, path), "::")
+	if !ok {
+		return ""
+	}
+	return owner
+}
+
+// declName returns the fully qualified name of a class or module declared
+// through path in namespace. A leading `::` makes path absolute.
+func declName(namespace string, path parser.Node) string {
+	full := constantPath(path)
+	if strings.HasPrefix(full, "::") {
+		return strings.TrimPrefix(full, "::")
+	}
+	return qualify(namespace, full)
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return "", s, false
+}
+
+func (i *Index) indexModule(node *parser.ModuleNode, file *sourceFile, sc scope) error {
+	if _, ok := node.Constantpath.(*parser.MissingNode); ok {
+		return i.indexProgram(node.Body, file, sc)
+	}
+	startLocation, err := file.location(int(node.Modulekeywordloc.StartOffset))
 	if err != nil {
 		return err
 	}
-	endLocation, err := locationFromOffset(src, path, int(node.Endkeywordloc.EndOffset()))
+	endLocation, err := file.location(int(node.Endkeywordloc.EndOffset()))
 	if err != nil {
 		return err
 	}
 	module := ModuleDecl{
-		Name: node.Name,
+		Name:  node.Name,
+		Owner: declOwner(sc, node.Constantpath),
+		Doc:   file.comments.docAbove(startLocation.Line),
 		r: &Range{
 			Start: startLocation,
 			End:   endLocation,
 		},
 	}
 	i.ModuleDecls = append(i.ModuleDecls, module)
-	return i.indexProgram(node.Body, path, src)
+	k := len(i.ModuleDecls) - 1
+	return i.indexProgram(node.Body, file, scope{
+		namespace: module.FullName(),
+		mixin: func(name string, extend bool) {
+			m := &i.ModuleDecls[k]
+			if extend {
+				m.Extends = append(m.Extends, name)
+			} else {
+				m.Includes = append(m.Includes, name)
+			}
+		},
+	})
 }
 
-func (i *Index) indexClass(node *parser.ClassNode, path string, src []byte) error {
-	startLoc, err := locationFromOffset(src, path, int(node.Classkeywordloc.StartOffset))
+func (i *Index) indexClass(node *parser.ClassNode, file *sourceFile, sc scope) error {
+	if _, ok := node.Constantpath.(*parser.MissingNode); ok {
+		return i.indexProgram(node.Body, file, sc)
+	}
+	startLoc, err := file.location(int(node.Classkeywordloc.StartOffset))
 	if err != nil {
 		return err
 	}
-	endLoc, err := locationFromOffset(src, path, int(node.Endkeywordloc.EndOffset()))
+	endLoc, err := file.location(int(node.Endkeywordloc.EndOffset()))
 	if err != nil {
 		return err
 	}
 	cls := ClassDecl{
-		Name: node.Name,
+		Name:       node.Name,
+		Owner:      declOwner(sc, node.Constantpath),
+		Superclass: constantPath(node.Superclass),
+		Doc:        file.comments.docAbove(startLoc.Line),
 		r: &Range{
 			Start: startLoc,
 			End:   endLoc,
 		},
 	}
+	if superclass, call, ok := structCall(node.Superclass); ok {
+		cls.Superclass = superclass
+		if err := i.structMembers(call, superclass, cls.FullName(), file); err != nil {
+			return err
+		}
+	}
 	i.ClassDecls = append(i.ClassDecls, cls)
-	return i.indexProgram(node.Body, path, src)
+	k := len(i.ClassDecls) - 1
+	return i.indexProgram(node.Body, file, scope{
+		namespace: cls.FullName(),
+		mixin: func(name string, extend bool) {
+			c := &i.ClassDecls[k]
+			if extend {
+				c.Extends = append(c.Extends, name)
+			} else {
+				c.Includes = append(c.Includes, name)
+			}
+		},
+	})
 }
 
-func (i *Index) indexMethod(node *parser.DefNode, path string, src []byte) error {
-	startLoc, err := locationFromOffset(src, path, int(node.Defkeywordloc.StartOffset))
+func (i *Index) indexMethod(node *parser.DefNode, file *sourceFile, sc scope, sig *sorbetSig) error {
+	startLoc, err := file.location(int(node.Defkeywordloc.StartOffset))
 	if err != nil {
 		return err
 	}
 	endLoc := startLoc
 	if node.Endkeywordloc != nil {
-		endLoc, err = locationFromOffset(src, path, int(node.Endkeywordloc.EndOffset()))
+		endLoc, err = file.location(int(node.Endkeywordloc.EndOffset()))
 		if err != nil {
 			return err
 		}
 	}
+	_, selfReceiver := node.Receiver.(*parser.SelfNode)
 	method := MethodDecl{
-		Name: node.Name,
+		Name:      node.Name,
+		Owner:     sc.namespace,
+		Singleton: sc.singleton || selfReceiver,
+		Signature: methodSignature(node, file.src),
+		Doc:       file.comments.docAbove(startLoc.Line),
+		Args:      parameterNames(node.Parameters),
 		r: &Range{
 			Start: startLoc,
 			End:   endLoc,
 		},
 	}
+	if !selfReceiver {
+		// A bare private does not apply to def self.x.
+		method.Visibility = sc.visibility
+	}
+	if sig != nil {
+		// The documentation sits above the sig rather than the def.
+		sigLoc, err := file.location(sig.offset)
+		if err != nil {
+			return err
+		}
+		method.Doc = file.comments.docAbove(sigLoc.Line)
+		method.Types = []MethodType{sig.methodType(node.Parameters)}
+	}
 	i.MethodDecls = append(i.MethodDecls, method)
 	return nil
 }
 
-func (i *Index) LookupConstant(constant string) ([]*Range, bool) {
-	if !i.Indexed {
-		return nil, false
+func (i *Index) indexConstant(node *parser.ConstantWriteNode, file *sourceFile, sc scope) error {
+	if superclass, call, ok := structCall(node.Value); ok {
+		return i.indexStruct(node, call, superclass, file, sc)
+	}
+	startLoc, err := file.location(int(node.Nameloc.StartOffset))
+	if err != nil {
+		return err
 	}
-	classRanges := mapp(filter(i.ClassDecls, func(c ClassDecl) bool {
-		return c.Name == constant
-	}), func(c ClassDecl) *Range {
-		return c.Range()
+	endLoc, err := file.location(int(node.Loc.EndOffset()))
+	if err != nil {
+		return err
+	}
+	value := node.Value.Location()
+	constant := ConstantDecl{
+		Name:  node.Name,
+		Owner: sc.namespace,
+		Value: firstLine(string(file.src[value.StartOffset:value.EndOffset()])),
+		Doc:   file.comments.docAbove(startLoc.Line),
+		r: &Range{
+			Start: startLoc,
+			End:   endLoc,
+		},
+	}
+	i.ConstantDecls = append(i.ConstantDecls, constant)
+	return nil
+}
+
+// indexCall indexes the methods defined by class body macros.
+func (i *Index) indexCall(node *parser.CallNode, file *sourceFile, sc scope, sig *sorbetSig) error {
+	if node.Receiver != nil && sc.namespace != "" {
+		return i.indexIteratedDefines(node, file, sc)
+	}
+	if node.Receiver != nil || node.Arguments == nil || sc.namespace == "" {
+		return nil
+	}
+	switch node.Name {
+	case "define_method", "define_singleton_method":
+		return i.indexDefineMethod(node, file, sc, nil)
+	case "attr_reader", "attr_writer", "attr_accessor":
+	case "include", "prepend", "extend":
+		if sc.mixin == nil {
+			return nil
+		}
+		for _, arg := range node.Arguments.Arguments {
+			if name := constantPath(arg); name != "" {
+				// Including into the singleton class extends the class.
+				sc.mixin(name, node.Name == "extend" || sc.singleton)
+			}
+		}
+		return nil
+	default:
+		return i.indexDSL(node, file, sc)
+	}
+	doc := (*Doc)(nil)
+	if sig != nil {
+		sigLoc, err := file.location(sig.offset)
+		if err != nil {
+			return err
+		}
+		doc = file.comments.docAbove(sigLoc.Line)
+	}
+	for _, arg := range node.Arguments.Arguments {
+		var name string
+		switch a := arg.(type) {
+		case *parser.SymbolNode:
+			name = a.Unescaped
+		case *parser.StringNode:
+			name = a.Unescaped
+		default:
+			continue
+		}
+		startLoc, err := file.location(int(arg.Location().StartOffset))
+		if err != nil {
+			return err
+		}
+		endLoc, err := file.location(int(arg.Location().EndOffset()))
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			doc = file.comments.docAbove(startLoc.Line)
+		}
+		r := &Range{Start: startLoc, End: endLoc}
+		signature := node.Name + " :" + name
+		reader := MethodDecl{Name: name, Owner: sc.namespace, Singleton: sc.singleton, Signature: signature, Doc: doc, r: r}
+		writer := MethodDecl{Name: name + "=", Owner: sc.namespace, Singleton: sc.singleton, Signature: signature, Doc: doc, Args: []string{name}, r: r}
+		if sig != nil && sig.returns != "" {
+			reader.Types = []MethodType{{Sig: sig.text, Text: "() -> " + sig.returns, Return: sig.returns}}
+			// Sorbet types the writer's parameter by the attribute name.
+			typ := sig.params[name]
+			if typ == "" {
+				typ = sig.returns
+			}
+			writer.Types = []MethodType{{
+				Sig:    sig.text,
+				Text:   "(" + typ + " " + name + ") -> " + typ,
+				Params: []TypedParam{{Name: name, Type: typ}},
+				Return: typ,
+			}}
+		}
+		if node.Name != "attr_writer" {
+			i.MethodDecls = append(i.MethodDecls, reader)
+		}
+		if node.Name != "attr_reader" {
+			i.MethodDecls = append(i.MethodDecls, writer)
+		}
+	}
+	return nil
+}
+
+// methodSignature returns the `def` line of a method up to the end of its
+// parameter list, e.g. `def self.fetch(id, cache: true)`.
+func methodSignature(node *parser.DefNode, src []byte) string {
+	end := node.Nameloc.EndOffset()
+	if node.Rparenloc != nil {
+		end = node.Rparenloc.EndOffset()
+	} else if node.Parameters != nil {
+		end = node.Parameters.Loc.EndOffset()
+	}
+	return firstLine(string(src[node.Defkeywordloc.StartOffset:end]))
+}
+
+func firstLine(s string) string {
+	line, _, found := strings.Cut(s, "\n")
+	if found {
+		return line + " ..."
+	}
+	return line
+}
+
+func parameterNames(params *parser.ParametersNode) []string {
+	if params == nil {
+		return nil
+	}
+	var names []string
+	add := func(nodes ...parser.Node) {
+		for _, n := range nodes {
+			switch p := n.(type) {
+			case *parser.RequiredParameterNode:
+				names = append(names, p.Name)
+			case *parser.OptionalParameterNode:
+				names = append(names, p.Name)
+			case *parser.RequiredKeywordParameterNode:
+				names = append(names, p.Name)
+			case *parser.OptionalKeywordParameterNode:
+				names = append(names, p.Name)
+			case *parser.RestParameterNode:
+				if p.Name != nil {
+					names = append(names, *p.Name)
+				}
+			case *parser.KeywordRestParameterNode:
+				if p.Name != nil {
+					names = append(names, *p.Name)
+				}
+			case *parser.BlockParameterNode:
+				if p.Name != nil {
+					names = append(names, *p.Name)
+				}
+			}
+		}
+	}
+	add(params.Requireds...)
+	add(params.Optionals...)
+	add(params.Rest)
+	add(params.Posts...)
+	add(params.Keywords...)
+	add(params.Keywordrest)
+	if params.Block != nil {
+		add(params.Block)
+	}
+	return names
+}
+
+// LookupConstant returns the declarations of constant, those in the file
+// the autoloader would load them from first. Files under an autoload root
+// that should define the constant are the fallback.
+func (i *Index) LookupConstant(constant string) ([]*Range, bool) {
+	nodes := i.Constants(constant)
+	sort.SliceStable(nodes, func(a, b int) bool {
+		return i.canonical(nodes[a]) && !i.canonical(nodes[b])
 	})
-	moduleRanges := mapp(filter(i.ModuleDecls, func(c ModuleDecl) bool {
-		return c.Name == constant
-	}), func(c ModuleDecl) *Range {
-		return c.Range()
+	ranges := mapp(nodes, func(n Node) *Range {
+		return n.Range()
 	})
-	var res []*Range
-	res = append(res, moduleRanges...)
-	res = append(res, classRanges...)
-	return res, len(res) > 0
+	if len(ranges) == 0 {
+		ranges = i.autoloadedFiles(constant)
+	}
+	return ranges, len(ranges) > 0
 }
 
-func (i *Index) LookupIdentifier(ident string) ([]*Range, bool) {
-	if !i.Indexed {
-		return nil, false
+// Constants returns the modules, classes and constants declared with the
+// given name, workspace declarations first.
+func (i *Index) Constants(name string) []Node {
+	var res []Node
+	for _, l := range i.layers() {
+		res = append(res, l.table().constants[name]...)
 	}
-	ranges := mapp(filter(i.MethodDecls, func(c MethodDecl) bool {
-		return c.Name == ident
-	}), func(c MethodDecl) *Range {
-		return c.Range()
+	return res
+}
+
+func (i *Index) LookupIdentifier(ident string) ([]*Range, bool) {
+	ranges := mapp(i.Methods(ident), func(m *MethodDecl) *Range {
+		return m.Range()
 	})
 	return ranges, len(ranges) > 0
 }
 
+func (i *Index) Methods(name string) []*MethodDecl {
+	var res []*MethodDecl
+	for _, l := range i.layers() {
+		res = append(res, l.table().methods[name]...)
+	}
+	return res
+}
+
+// layers returns the indexes searched by lookups, in order.
+func (i *Index) layers() []*Index {
+	var res []*Index
+	if i.Indexed {
+		res = append(res, i)
+	}
+	if i.Dependencies != nil {
+		res = append(res, i.Dependencies.layers()...)
+	}
+	if i.Builtins != nil {
+		res = append(res, i.Builtins.layers()...)
+	}
+	return res
+}
+
+// MethodsOf returns the methods declared directly on the class or module
+// with the given fully qualified name.
+func (i *Index) MethodsOf(owner string, singleton bool) []*MethodDecl {
+	var res []*MethodDecl
+	for _, l := range i.layers() {
+		res = append(res, l.table().owners[ownerKey(owner, singleton)]...)
+	}
+	return res
+}
+
+// Ancestors returns the method resolution order of the class or module
+// with the given fully qualified name: the receiver, its mixins, most
+// recently included first, then the ancestors of its superclass. Classes
+// without a declared superclass inherit from Object.
+func (i *Index) Ancestors(name string) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for name != "" && !seen[name] {
+		seen[name] = true
+		res = append(res, name)
+		superclass, isClass := "", false
+		var includes []string
+		for _, l := range i.layers() {
+			for _, c := range l.table().classes[name] {
+				isClass = true
+				for _, inc := range c.Includes {
+					includes = append(includes, i.qualifyIn(c.Owner, inc))
+				}
+				if superclass == "" && c.Superclass != "" {
+					superclass = i.qualifyIn(c.Owner, c.Superclass)
+				}
+			}
+			for _, m := range l.table().modules[name] {
+				for _, inc := range m.Includes {
+					includes = append(includes, i.qualifyIn(m.Owner, inc))
+				}
+			}
+		}
+		for k := len(includes) - 1; k >= 0; k-- {
+			for _, a := range i.Ancestors(strings.TrimPrefix(includes[k], "::")) {
+				if !seen[a] {
+					seen[a] = true
+					res = append(res, a)
+				}
+			}
+		}
+		if isClass && superclass == "" && name != "BasicObject" && name != "Object" {
+			superclass = "Object"
+		}
+		if name == "Object" && superclass == "" {
+			superclass = "BasicObject"
+		}
+		name = strings.TrimPrefix(superclass, "::")
+	}
+	return res
+}
+
+// qualifyIn returns the full name of a constant written in the namespace
+// owner, trying the enclosing namespaces from the innermost out.
+func (i *Index) qualifyIn(owner, name string) string {
+	if strings.HasPrefix(name, "::") {
+		return strings.TrimPrefix(name, "::")
+	}
+	for owner != "" {
+		if full := qualify(owner, name); len(i.constantsNamed(full)) > 0 {
+			return full
+		}
+		owner, _, _ = cutLast(owner, "::")
+	}
+	return name
+}
+
 func filter[S ~[]E, E any](s S, f func(E) bool) S {
 	var res S
 	for _, v := range s {
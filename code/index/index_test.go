@@ -2,9 +2,15 @@ package index
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/tjgurwara99/go-ruby-prism/parser"
 
@@ -74,3 +80,1192 @@ func BenchmarkTreeSitterParser(b *testing.B) {
 		parser.ParseCtx(ctx, nil, src)
 	}
 }
+
+// syntheticIndex builds an index the size of a large monolith: classes
+// spread over namespaces, each with its own methods and constants.
+func syntheticIndex(classes, methods int) *Index {
+	i := &Index{Root: "/synthetic"}
+	for c := 0; c < classes; c++ {
+		owner := fmt.Sprintf("Namespace%d", c%100)
+		name := fmt.Sprintf("Class%d", c)
+		path := fmt.Sprintf("/synthetic/app/models/namespace%d/class%d.rb", c%100, c)
+		r := &Range{Start: &Location{FileURI: path}, End: &Location{Line: methods * 3, FileURI: path}}
+		i.ClassDecls = append(i.ClassDecls, ClassDecl{Name: name, Owner: owner, Superclass: "ApplicationRecord", r: r})
+		i.ConstantDecls = append(i.ConstantDecls, ConstantDecl{Name: "TABLE", Owner: owner + "::" + name, r: r})
+		for m := 0; m < methods; m++ {
+			loc := &Location{Line: m * 3, FileURI: fmt.Sprintf("/synthetic/app/models/namespace%d/class%d.rb", c%100, c)}
+			i.MethodDecls = append(i.MethodDecls, MethodDecl{
+				Name:  fmt.Sprintf("method_%d", m),
+				Owner: fmt.Sprintf("Namespace%d::Class%d", c%100, c),
+				r:     &Range{Start: loc, End: loc},
+			})
+		}
+	}
+	i.finish()
+	return i
+}
+
+func BenchmarkLookupIdentifier(b *testing.B) {
+	i := syntheticIndex(20000, 10)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i.LookupIdentifier("method_7")
+	}
+}
+
+func BenchmarkLookupConstant(b *testing.B) {
+	i := syntheticIndex(20000, 10)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i.LookupConstant("Class12345")
+	}
+}
+
+func BenchmarkConstantNamesPrefix(b *testing.B) {
+	i := syntheticIndex(20000, 10)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i.ConstantNames("Class123")
+	}
+}
+
+func BenchmarkIndexFootprint(b *testing.B) {
+	b.ReportAllocs()
+	var stats runtime.MemStats
+	for n := 0; n < b.N; n++ {
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		before := stats.HeapAlloc
+		i := syntheticIndex(20000, 10)
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		b.ReportMetric(float64(stats.HeapAlloc-before)/(1<<20), "heap-MiB")
+		runtime.KeepAlive(i)
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	i := New("./testdata/docs")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	modules := i.Constants("Payments")
+	if len(modules) != 1 {
+		t.Fatalf("expected one Payments module, got %d", len(modules))
+	}
+	if doc := modules[0].(*ModuleDecl).Doc; doc == nil || doc.Text != "Payments are processed by the gateway configured for the account." {
+		t.Fatalf("unexpected module doc: %+v", doc)
+	}
+	constants := i.Constants("DEFAULT_CURRENCY")
+	if len(constants) != 1 || constants[0].(*ConstantDecl).FullName() != "Payments::DEFAULT_CURRENCY" {
+		t.Fatalf("unexpected constants: %+v", constants)
+	}
+	charge := i.Constants("Charge")[0].(*ClassDecl)
+	if charge.Superclass != "Base" || len(charge.Doc.Examples) != 1 || charge.Doc.Examples[0].Code != "Payments::Charge.new(account).call(100)" {
+		t.Fatalf("unexpected class decl: %+v %+v", charge, charge.Doc)
+	}
+
+	call := i.Methods("call")[0]
+	if call.FullName() != "Payments::Charge#call" || call.Signature != "def call(amount, currency = DEFAULT_CURRENCY)" {
+		t.Fatalf("unexpected method decl: %+v", call)
+	}
+	doc := call.Doc
+	if doc.Text != "Performs the charge." || len(doc.Params) != 2 {
+		t.Fatalf("unexpected method doc: %+v", doc)
+	}
+	if p := doc.Params[1]; p.Name != "currency" || p.Types[0] != "String" || p.Text != "ISO currency code defaulting to GBP" {
+		t.Fatalf("unexpected param tag: %+v", p)
+	}
+	if doc.Return == nil || len(doc.Return.Types) != 2 || doc.Raises[0].Types[0] != "GatewayError" {
+		t.Fatalf("unexpected return/raise tags: %+v %+v", doc.Return, doc.Raises)
+	}
+
+	charge2 := i.Methods("charge!")[0]
+	if !charge2.Singleton || charge2.Doc.Deprecated == nil || *charge2.Doc.Deprecated != "Use {#call} instead." {
+		t.Fatalf("unexpected deprecated method: %+v", charge2)
+	}
+	if gateway := i.Methods("gateway")[0]; gateway.FullName() != "Payments::Charge.gateway" {
+		t.Fatalf("unexpected singleton method: %s", gateway.FullName())
+	}
+	if undocumented := i.Methods("undocumented")[0]; undocumented.Doc != nil {
+		t.Fatalf("expected no doc, got %+v", undocumented.Doc)
+	}
+}
+
+func TestParseGemfileLock(t *testing.T) {
+	data, err := os.ReadFile("./testdata/gems/Gemfile.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gems := ParseGemfileLock(data)
+	want := []string{
+		"activesupport-0123456789ab",
+		"billing-0.1.0",
+		"concurrent-ruby-1.2.3",
+		"nokogiri-1.16.0-x86_64-linux",
+		"rack-3.0.8",
+	}
+	if len(gems) != len(want) {
+		t.Fatalf("expected %d gems, got %+v", len(want), gems)
+	}
+	for k, g := range gems {
+		if g.DirName() != want[k] {
+			t.Errorf("gem %d: expected %s, got %s", k, want[k], g.DirName())
+		}
+	}
+	if gems[1].Source != GemSourcePath || gems[1].Remote != "../engines/billing" {
+		t.Errorf("unexpected path gem: %+v", gems[1])
+	}
+}
+
+func TestIndexGems(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GEM_HOME", "")
+	t.Setenv("GEM_PATH", "")
+	t.Setenv("BUNDLE_PATH", "")
+	for run := 0; run < 2; run++ {
+		i := New("./testdata/gems")
+		if err := i.Start(log.Default()); err != nil {
+			t.Fatal(err)
+		}
+		if len(i.Dependencies.Constants("Rack")) != 1 || len(i.Constants("Request")) != 1 {
+			t.Fatalf("run %d: expected gem declarations to be indexed", run)
+		}
+		if len(i.MethodDecls) != 1 {
+			t.Fatalf("run %d: vendored gems must not be indexed as workspace files", run)
+		}
+		methods := i.Methods("params")
+		if len(methods) != 2 || methods[0].Owner != "Server" || methods[1].Owner != "Rack::Request" {
+			t.Fatalf("run %d: expected workspace method before gem method, got %+v", run, methods)
+		}
+		if doc := i.Constants("Rack")[0].(*ModuleDecl).Doc; doc == nil || doc.Text != "The Rack main module." {
+			t.Fatalf("run %d: unexpected doc %+v", run, doc)
+		}
+	}
+	gem := LockedGem{Name: "rack", Version: "3.0.8"}
+	a, _ := cachePath(gem, "/opt/ruby-3.2/gems/rack-3.0.8")
+	b, _ := cachePath(gem, "/opt/ruby-3.3/gems/rack-3.0.8")
+	if a == b {
+		t.Fatalf("gems installed in different directories share the cache %s", a)
+	}
+}
+
+func TestRBSSignatures(t *testing.T) {
+	i := New("./testdata/rbs")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	invoices := i.Constants("Invoice")
+	if len(invoices) != 1 {
+		t.Fatalf("expected the RBS class to merge with the Ruby one, got %d", len(invoices))
+	}
+	invoice := invoices[0].(*ClassDecl)
+	if invoice.Superclass != "Document" || invoice.Doc == nil || invoice.Doc.Text != "Invoices sent to customers." {
+		t.Fatalf("unexpected merged class: %+v", invoice)
+	}
+
+	addLine := i.Methods("add_line")
+	if len(addLine) != 1 || len(addLine[0].Types) != 2 || addLine[0].Doc.Text != "Adds a line to the invoice." {
+		t.Fatalf("unexpected add_line: %+v", addLine)
+	}
+	params := addLine[0].Types[0].Params
+	if len(params) != 3 || params[0].Name != "description" || params[0].Type != "String" ||
+		params[2].Kind != ParamOptionalKeyword || params[2].Type != "Integer?" || addLine[0].Types[0].Return != "self" {
+		t.Fatalf("unexpected add_line params: %+v", params)
+	}
+
+	find := i.Methods("find")
+	if len(find) != 1 || !find[0].Singleton || len(find[0].Types) != 2 {
+		t.Fatalf("unexpected find: %+v", find)
+	}
+	if block := find[0].Types[1].Params[1]; block.Kind != ParamBlock || block.Type != "{ (Invoice) -> T }" {
+		t.Fatalf("unexpected block param: %+v", block)
+	}
+	if lines := i.Methods("lines"); len(lines) != 1 || lines[0].Types[0].Return != "(Array[Line] | nil)" {
+		t.Fatalf("unexpected union return: %+v", lines)
+	}
+	if build := i.Methods("build"); len(build) != 2 || build[0].Types[0].Params[1].Kind != ParamKeywordRest {
+		t.Fatalf("unexpected self? method: %+v", build)
+	}
+	if total := i.Methods("total"); len(total) != 1 || total[0].Types[0].Return != "Integer" || total[0].Signature != "attr_reader :total" {
+		t.Fatalf("expected interface methods to be skipped and the attribute to merge: %+v", total)
+	}
+	if amount := i.Methods("amount="); len(amount) != 1 || amount[0].Owner != "Billing::Line" {
+		t.Fatalf("unexpected attribute writer: %+v", amount)
+	}
+	if rate := i.Constants("TAX_RATE"); len(rate) != 1 || rate[0].(*ConstantDecl).Value != "Float" {
+		t.Fatalf("unexpected constant: %+v", rate)
+	}
+}
+
+func TestSorbetSignatures(t *testing.T) {
+	i := New("./testdata/sorbet")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	deposit := i.Methods("deposit")
+	if len(deposit) != 1 || len(deposit[0].Types) != 1 || deposit[0].Doc == nil || deposit[0].Doc.Text != "Deposits money into the account." {
+		t.Fatalf("unexpected deposit: %+v", deposit)
+	}
+	if text := deposit[0].Types[0].Text; text != "(Integer amount, ?note: T.nilable(String), &T.proc.void block) -> T::Boolean" {
+		t.Fatalf("unexpected method type: %s", text)
+	}
+	if merge := i.Methods("merge!"); merge[0].Types[0].Return != "void" || merge[0].Types[0].Params[0].Type != "Account" {
+		t.Fatalf("unexpected multiline sig: %+v", merge[0].Types)
+	}
+	if name := i.Methods("name"); len(name) != 1 || name[0].Types[0].Return != "String" {
+		t.Fatalf("unexpected attribute: %+v", name)
+	}
+	if untyped := i.Methods("untyped"); len(untyped[0].Types) != 0 {
+		t.Fatalf("a sig must only apply to the statement following it: %+v", untyped[0].Types)
+	}
+	balance := i.Methods("balance")
+	if len(balance) != 1 || !strings.HasSuffix(balance[0].Range().Start.FileURI, "account.rb") || balance[0].Types[0].Return != "Money" {
+		t.Fatalf("expected the RBI sig to merge into the Ruby method: %+v", balance)
+	}
+	money := i.Constants("Money")
+	if len(money) != 1 || money[0].(*ClassDecl).Doc.Text != "Money represents an amount in a currency." {
+		t.Fatalf("expected RBI-only classes to be indexed: %+v", money)
+	}
+	if init := i.Methods("initialize"); len(init) != 1 || init[0].Types[0].Params[1].Type != "String" {
+		t.Fatalf("unexpected RBI method: %+v", init)
+	}
+}
+
+func TestCoreDeclarations(t *testing.T) {
+	i := New("./testdata/rbs")
+	i.Builtins = Core()
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	var gsub *MethodDecl
+	for _, m := range i.MethodsOf("String", false) {
+		if m.Name == "gsub" {
+			gsub = m
+		}
+	}
+	if gsub == nil || len(gsub.Types) != 2 || gsub.Doc == nil || gsub.Range().Start.FileURI != CorePath {
+		t.Fatalf("unexpected String#gsub: %+v", gsub)
+	}
+	if slice := i.Methods("each_slice"); len(slice) != 2 || slice[0].Owner != "Enumerable" {
+		t.Fatalf("unexpected each_slice: %+v", slice)
+	}
+	ancestors := strings.Join(i.Ancestors("Integer"), " ")
+	if ancestors != "Integer Numeric Comparable Object Kernel BasicObject" {
+		t.Fatalf("unexpected ancestors: %s", ancestors)
+	}
+	if invoice := i.Ancestors("Billing::Invoice"); len(invoice) < 2 || invoice[1] != "Document" {
+		t.Fatalf("unexpected workspace ancestors: %v", invoice)
+	}
+}
+
+func TestAutoload(t *testing.T) {
+	i := New("./testdata/rails")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"testdata/rails/app/models/billing/invoice.rb":    "Billing::Invoice",
+		"testdata/rails/app/models/concerns/priceable.rb": "Priceable",
+		"testdata/rails/lib/html_sanitizer.rb":            "HtmlSanitizer",
+	} {
+		if got, ok := i.ExpectedConstant(path); !ok || got != want {
+			t.Errorf("ExpectedConstant(%s) = %s, want %s", path, got, want)
+		}
+	}
+	ranges, ok := i.LookupConstant("Invoice")
+	if !ok || len(ranges) != 2 || ranges[0].Start.FileURI != "testdata/rails/app/models/billing/invoice.rb" {
+		t.Fatalf("expected the autoloaded definition first: %+v", ranges)
+	}
+	ranges, ok = i.LookupConstant("PdfRenderer")
+	if !ok || ranges[0].Start.FileURI != "testdata/rails/app/services/pdf_renderer.rb" {
+		t.Fatalf("expected to fall back to the autoload path: %+v", ranges)
+	}
+	m, ok := i.CheckAutoload("testdata/rails/app/models/user.rb")
+	if !ok || m.Expected != "User" || len(m.Defined) != 1 || m.Defined[0] != "Account" {
+		t.Errorf("unexpected mismatch: %+v, %t", m, ok)
+	}
+	if m, ok := i.CheckAutoload("testdata/rails/app/admin/invoice_tweaks.rb"); !ok || m.Expected != "InvoiceTweaks" {
+		t.Errorf("unexpected mismatch: %+v, %t", m, ok)
+	}
+	for _, path := range []string{
+		"testdata/rails/app/models/billing/invoice.rb",
+		"testdata/rails/app/models/order.rb",
+		"testdata/rails/db/schema.rb",
+	} {
+		if m, ok := i.CheckAutoload(path); ok {
+			t.Errorf("CheckAutoload(%s) = %+v", path, m)
+		}
+	}
+}
+
+func TestFileSelection(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".git/info/exclude":         "scratch.rb\n",
+		".gitignore":                "# build output\ntmp/\n*.generated.rb\n!keep.generated.rb\n",
+		"Gemfile":                   "source 'https://rubygems.org'\n",
+		"Rakefile":                  "task :default\n",
+		"app.gemspec":               "Gem::Specification.new\n",
+		"config.ru":                 "run App\n",
+		"bin/console":               "#!/usr/bin/env ruby\nclass Console; end\n",
+		"bin/setup":                 "#!/bin/sh\n",
+		"lib/tasks/db.rake":         "namespace :db do\nend\n",
+		"lib/schema.generated.rb":   "class Schema; end\n",
+		"lib/keep.generated.rb":     "class Keep; end\n",
+		"lib/legacy/old.rb":         "class Old; end\n",
+		"lib/nested/.gitignore":     "/local.rb\n",
+		"lib/nested/local.rb":       "class Local; end\n",
+		"lib/nested/deep/local.rb":  "class DeepLocal; end\n",
+		"node_modules/pkg/index.rb": "class Pkg; end\n",
+		"scratch.rb":                "class Scratch; end\n",
+		"tmp/cache.rb":              "class Cache; end\n",
+		"notes.txt":                 "class Notes; end\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i := New(root)
+	i.Exclude = append([]string{"lib/legacy/"}, DefaultExclude...)
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	var indexed []string
+	for _, f := range i.files {
+		rel, _ := filepath.Rel(root, f)
+		indexed = append(indexed, filepath.ToSlash(rel))
+	}
+	want := "Gemfile Rakefile app.gemspec bin/console config.ru lib/keep.generated.rb lib/nested/deep/local.rb lib/tasks/db.rake"
+	if got := strings.Join(indexed, " "); got != want {
+		t.Fatalf("indexed %s, want %s", got, want)
+	}
+	for name, want := range map[string]string{
+		"lib/keep.generated.rb":   "indexed as Ruby source",
+		"lib/schema.generated.rb": "ignored by .gitignore:3 (*.generated.rb)",
+		"lib/legacy/old.rb":       `directory lib/legacy excluded by pattern "lib/legacy/"`,
+		"lib/nested/local.rb":     "ignored by lib/nested/.gitignore:1 (/local.rb)",
+		"scratch.rb":              "ignored by .git/info/exclude:1 (scratch.rb)",
+		"tmp/cache.rb":            "directory tmp ignored by .gitignore:2 (tmp/)",
+		"bin/setup":               "not a Ruby file",
+	} {
+		if _, reason := i.ExplainFile(filepath.Join(root, name)); reason != want {
+			t.Errorf("ExplainFile(%s) = %q, want %q", name, reason, want)
+		}
+	}
+	i = New(root)
+	i.Include = []string{"lib/**"}
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	if indexed, reason := i.ExplainFile(filepath.Join(root, "Gemfile")); indexed || reason != "not matched by the include patterns" {
+		t.Fatalf("unexpected explanation for Gemfile: %s", reason)
+	}
+}
+
+func TestWorkspaceSnapshots(t *testing.T) {
+	w := NewWorkspace("./testdata/rbs")
+	if _, err := w.Snapshot(10 * time.Millisecond); err != ErrNotIndexed {
+		t.Fatalf("expected queries to time out before the first snapshot, got %v", err)
+	}
+	go w.Index(log.Default())
+	first, err := w.Snapshot(30 * time.Second)
+	if err != nil || first.Generation != 1 || len(first.Methods("add_line")) != 1 {
+		t.Fatalf("unexpected first snapshot: %+v %v", first, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := w.Index(log.Default()); err != nil {
+			t.Error(err)
+		}
+	}()
+	// The published snapshot stays usable while the next one is built.
+	for k := 0; k < 100; k++ {
+		if len(first.Methods("add_line")) != 1 {
+			t.Fatal("snapshot changed while reindexing")
+		}
+	}
+	<-done
+	second, _ := w.Snapshot(0)
+	if second.Generation != 2 || second == first {
+		t.Fatalf("expected a new generation, got %d", second.Generation)
+	}
+}
+
+func TestPublishFinishesLayers(t *testing.T) {
+	w := NewWorkspace("")
+	i := &Index{ClassDecls: []ClassDecl{{Name: "App"}}}
+	i.Dependencies = &Index{ModuleDecls: []ModuleDecl{{Name: "Rack"}}}
+	w.publish(i)
+	snapshot, err := w.Snapshot(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"App", "Rack"} {
+		if _, _, ok := snapshot.ResolveConstant(name, nil); !ok {
+			t.Errorf("%s does not resolve in the published snapshot", name)
+		}
+	}
+}
+
+func TestFaultTolerantIndexing(t *testing.T) {
+	i := New("./testdata/broken")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Constants("Ok")) != 1 || len(i.Methods("fine")) != 1 {
+		t.Fatal("expected files after a broken one to be indexed")
+	}
+	unclosed := i.Constants("Unclosed")
+	if len(unclosed) != 1 || len(i.Methods("before_eof")) != 1 {
+		t.Fatalf("expected a class closed by the end of the file to be indexed: %+v", unclosed)
+	}
+	if end := unclosed[0].Range().End; end.Line != 3 || end.Character != 0 {
+		t.Fatalf("unexpected end of file location: %+v", end)
+	}
+	if len(i.Constants("Partial")) != 1 || len(i.Methods("valid")) != 1 {
+		t.Fatal("expected the valid part of a file with syntax errors to be indexed")
+	}
+	if len(i.Problems) != 2 {
+		t.Fatalf("expected a problem per broken file: %+v", i.Problems)
+	}
+	for _, p := range i.Problems {
+		if !p.Partial || !strings.HasPrefix(p.Message, "syntax error: ") {
+			t.Fatalf("unexpected problem: %+v", p)
+		}
+	}
+}
+
+func TestLineIndex(t *testing.T) {
+	src := []byte("name = \"😀\" # é\n\nputs name\n")
+	lines := NewLineIndex(src)
+	for _, tt := range []struct {
+		offset, line, character int
+	}{
+		{0, 0, 0},
+		{8, 0, 8},   // the emoji
+		{12, 0, 10}, // the closing quote after a surrogate pair
+		{18, 0, 15}, // after é
+		{19, 1, 0},
+		{20, 2, 0},
+		{len(src), 3, 0},
+	} {
+		line, character := lines.Position(tt.offset)
+		if line != tt.line || character != tt.character {
+			t.Errorf("Position(%d) = %d:%d, want %d:%d", tt.offset, line, character, tt.line, tt.character)
+		}
+		if offset := lines.Offset(tt.line, tt.character); offset != tt.offset {
+			t.Errorf("Offset(%d, %d) = %d, want %d", tt.line, tt.character, offset, tt.offset)
+		}
+	}
+	if column := lines.Column(0, 10); column != 12 {
+		t.Errorf("Column(0, 10) = %d, want 12", column)
+	}
+	if character := lines.Character(0, 12); character != 10 {
+		t.Errorf("Character(0, 12) = %d, want 10", character)
+	}
+	if offset := lines.Offset(1, 5); offset != 19 {
+		t.Errorf("expected positions past the end of a line to clamp, got %d", offset)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	i := New("./testdata/refs")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		constant bool
+		want     []Reference
+	}{
+		{"Account", true, []Reference{{Kind: RefConstant, Scope: "AccountsController", Method: "show"}}},
+		{"Ledger", true, []Reference{{Kind: RefConstant, Scope: "AccountsController", Method: "render_account"}}},
+		{"ApplicationController", true, []Reference{{Kind: RefConstant}}},
+		{"AccountsController", true, nil},
+		{"Clock", true, []Reference{{Kind: RefConstant, Scope: "AuditLog", Method: "record"}}},
+		{"authenticate", false, []Reference{{Kind: RefSymbol, Scope: "AccountsController"}}},
+		{"signed_in?", false, []Reference{{Kind: RefSymbol, Scope: "AccountsController"}}},
+		{"find", false, []Reference{{Kind: RefCall, Receiver: ReceiverConstant, Scope: "AccountsController", Method: "show"}}},
+		{"show", false, []Reference{
+			{Kind: RefSymbol, Scope: "AccountsController"},
+			{Kind: RefSuper, Scope: "AccountsController", Method: "show"},
+		}},
+		{"render_account", false, []Reference{
+			{Kind: RefCall, Receiver: ReceiverSelf, Scope: "AccountsController", Method: "show"},
+			{Kind: RefCall, Receiver: ReceiverExpression, Scope: "AccountsController", Method: "render_account"},
+		}},
+	}
+	for _, tt := range tests {
+		kinds := []RefKind{RefCall, RefSuper, RefSymbol}
+		if tt.constant {
+			kinds = []RefKind{RefConstant}
+		}
+		refs := i.ReferencesTo(tt.name, kinds...)
+		if len(refs) != len(tt.want) {
+			t.Errorf("ReferencesTo(%s) = %d references, want %d", tt.name, len(refs), len(tt.want))
+			continue
+		}
+		for k, ref := range refs {
+			want := tt.want[k]
+			if ref.Kind != want.Kind || ref.Receiver != want.Receiver || ref.Scope != want.Scope || ref.Method != want.Method {
+				t.Errorf("ReferencesTo(%s)[%d] = %+v, want %+v", tt.name, k, *ref, want)
+			}
+		}
+	}
+	r := i.ReferencesTo("authenticate", RefSymbol)[0].Range()
+	if r.Start.Line != 1 || r.Start.Character != 17 || r.End.Character != 29 {
+		t.Errorf("unexpected range for :authenticate: %+v %+v", r.Start, r.End)
+	}
+}
+
+func TestResolvedReferences(t *testing.T) {
+	i := New("./testdata/samenames")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	lines := func(refs []*Reference) []int {
+		var res []int
+		for _, ref := range refs {
+			res = append(res, ref.Range().Start.Line)
+		}
+		return res
+	}
+	constants := []struct {
+		path    string
+		nesting []string
+		want    []int
+	}{
+		{"Report", []string{"Billing::Invoice", "Billing"}, []int{13, 15}},
+		{"Report", nil, []int{14}},
+		{"::Report", []string{"Billing"}, []int{14}},
+	}
+	for _, tt := range constants {
+		if got := lines(i.ConstantReferencesTo(tt.path, tt.nesting)); !slices.Equal(got, tt.want) {
+			t.Errorf("ConstantReferencesTo(%s, %v) on lines %v, want %v", tt.path, tt.nesting, got, tt.want)
+		}
+	}
+	methods := []struct {
+		owner string
+		t     Type
+		name  string
+		want  []int
+	}{
+		{"Billing::Report", Type{Name: "Billing::Report"}, "total", []int{7}},
+		{"Report", Type{Name: "Report"}, "total", []int{26}},
+		{"Billing::Report", Type{Name: "Billing::Report", Singleton: true}, "build", []int{13}},
+		{"Report", Type{Name: "Report", Singleton: true}, "build", []int{14}},
+	}
+	for _, tt := range methods {
+		target := i.MethodsFor(tt.t, tt.name)
+		if len(target) == 0 || target[0].Owner != tt.owner {
+			t.Errorf("MethodsFor(%+v, %s) = %v", tt.t, tt.name, target)
+			continue
+		}
+		if got := lines(i.MethodReferencesTo(tt.name, target[:1])); !slices.Equal(got, tt.want) {
+			t.Errorf("MethodReferencesTo(%s of %s) on lines %v, want %v", tt.name, tt.owner, got, tt.want)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	i := New("./testdata/refs")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		singleton bool
+		want      []string
+	}{
+		{"@user", false, []string{"Session#login"}},
+		{"@created_at", false, []string{"Base#initialize"}},
+		{"@registry", true, []string{"Session"}},
+		{"@registry", false, nil},
+		{"@tracked", true, []string{"Session#track"}},
+		{"@@count", false, []string{"Session", "Session#reset"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, v := range i.Variables("Session", tt.name, tt.singleton) {
+			where := v.Owner
+			if v.Method != "" {
+				where += "#" + v.Method
+			}
+			got = append(got, where)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Variables(Session, %s, %t) = %v, want %v", tt.name, tt.singleton, got, tt.want)
+		}
+	}
+	names := i.VariableNames("Session", "@", false)
+	if strings.Join(names, ",") != "@user,@token,@attempts,@created_at" {
+		t.Errorf("unexpected instance variables: %v", names)
+	}
+	if names := i.VariableNames("Session", "@@", false); len(names) != 1 || names[0] != "@@count" {
+		t.Errorf("unexpected class variables: %v", names)
+	}
+}
+
+func TestLocals(t *testing.T) {
+	src, err := os.ReadFile("./testdata/locals/locals.rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope, err := Locals(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := NewLineIndex(src)
+	at := func(line, column int) int {
+		return lines.Offset(line, column)
+	}
+	tests := []struct {
+		name         string
+		line, column int
+		// defLine is the line of the definition, -1 when not visible.
+		defLine int
+		kind    LocalKind
+	}{
+		{"total", 25, 0, 0, LocalAssigned},
+		{"total", 6, 4, -1, 0},
+		{"header", 6, 4, -1, 0},
+		{"rows", 7, 4, 5, LocalParam},
+		{"width", 22, 4, 5, LocalParam},
+		{"height", 22, 4, 5, LocalParam},
+		{"opts", 22, 4, 5, LocalParam},
+		{"blk", 22, 4, 5, LocalParam},
+		{"count", 8, 6, 6, LocalAssigned},
+		{"buffer", 9, 6, 7, LocalBlockLocal},
+		{"buffer", 13, 4, -1, 0},
+		{"cells", 13, 4, -1, 0},
+		{"_1", 10, 25, 10, LocalImplicit},
+		{"it", 11, 25, 11, LocalImplicit},
+		{"error", 16, 11, 15, LocalAssigned},
+		{"label", 20, 6, 19, LocalAssigned},
+		{"size", 20, 6, 19, LocalAssigned},
+		{"first", 22, 20, 22, LocalAssigned},
+		{"second", 21, 4, -1, 0},
+	}
+	for _, tt := range tests {
+		l := scope.Lookup(tt.name, at(tt.line, tt.column))
+		if tt.defLine < 0 {
+			if l != nil {
+				t.Errorf("%s should not be visible at %d:%d", tt.name, tt.line, tt.column)
+			}
+			continue
+		}
+		if l == nil {
+			t.Errorf("%s should be visible at %d:%d", tt.name, tt.line, tt.column)
+			continue
+		}
+		if line := lines.Line(l.Start); line != tt.defLine || l.Kind != tt.kind || string(src[l.Start:l.End]) != tt.name && l.Kind != LocalImplicit {
+			t.Errorf("%s at %d:%d resolved to %+v on line %d", tt.name, tt.line, tt.column, *l, line)
+		}
+	}
+	var visible []string
+	for _, l := range scope.Visible(at(9, 6)) {
+		visible = append(visible, l.Name)
+	}
+	if strings.Join(visible, ",") != "row,buffer,rows,title,rest,width,height,opts,blk,count" {
+		t.Errorf("unexpected visible locals: %v", visible)
+	}
+}
+
+func TestRequires(t *testing.T) {
+	i := New("./testdata/requires")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range i.DependencyGraph() {
+		got = append(got, fmt.Sprintf("%s %s %q -> %s", d.From, d.Require.Method, d.Require.Path, d.To))
+	}
+	want := []string{
+		`testdata/requires/app/checkout.rb require "json" -> `,
+		`testdata/requires/app/checkout.rb require "pricing" -> testdata/requires/lib/pricing.rb`,
+		`testdata/requires/app/checkout.rb require_relative "../lib/pricing" -> testdata/requires/lib/pricing.rb`,
+		`testdata/requires/app/checkout.rb load "./config/setup.rb" -> testdata/requires/config/setup.rb`,
+		`testdata/requires/lib/pricing.rb autoload "pricing/tax" -> testdata/requires/lib/pricing/tax.rb`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected dependency graph:\n%s", strings.Join(got, "\n"))
+	}
+	r := i.Requires[2].Range()
+	if r.Start.Line != 2 || r.Start.Character != 18 || r.End.Character != 32 {
+		t.Errorf("unexpected range for the require_relative path: %+v %+v", r.Start, r.End)
+	}
+	src, err := os.ReadFile("./testdata/requires/lib/pricing.rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requires, err := FileRequires("testdata/requires/lib/pricing.rb", src)
+	if err != nil || len(requires) != 1 || requires[0].Path != "pricing/tax" {
+		t.Fatalf("unexpected file requires: %+v %v", requires, err)
+	}
+	// Requires are resolved once per snapshot.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shop.rb"), []byte("require_relative \"tax\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tax.rb"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	i = New(dir)
+	if err := i.Start(log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := i.ResolveRequire(&i.Requires[0]); !ok {
+		t.Fatal("require_relative not resolved")
+	}
+	os.Remove(filepath.Join(dir, "tax.rb"))
+	if to, ok := i.ResolveRequire(&i.Requires[0]); !ok || to != filepath.Join(dir, "tax.rb") {
+		t.Errorf("resolved require not cached: %q", to)
+	}
+}
+
+func TestRailsDSL(t *testing.T) {
+	i := New("./testdata/rails")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range i.MethodsOf("Order", false) {
+		// The schema declares the column methods.
+		if !strings.HasSuffix(m.Range().Start.FileURI, "order.rb") {
+			continue
+		}
+		entry := m.Name
+		if len(m.Types) > 0 {
+			entry += " " + m.Types[0].Return
+		}
+		got = append(got, entry)
+	}
+	for _, m := range i.MethodsOf("Order", true) {
+		got = append(got, "."+m.Name+"("+strings.Join(m.Args, ", ")+")")
+	}
+	want := []string{
+		"account Account", "account=", "build_account Account", "create_account Account",
+		"create_account! Account", "reload_account Account",
+		"line_items ActiveRecord::Associations::CollectionProxy[LineItem]", "line_items=",
+		"line_item_ids Array[Integer]", "line_item_ids=",
+		"addresses ActiveRecord::Associations::CollectionProxy[PostalAddress]", "addresses=",
+		"address_ids Array[Integer]", "address_ids=",
+		"invoice Billing::Invoice", "invoice=", "build_invoice Billing::Invoice", "create_invoice Billing::Invoice",
+		"create_invoice! Billing::Invoice", "reload_invoice Billing::Invoice",
+		"name", "email", "invoice_total", "shipping_city",
+		".active()", ".placed_after(time)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected DSL methods:\n%s", strings.Join(got, "\n"))
+	}
+	account := i.Methods("build_account")[0]
+	if account.Signature != "belongs_to :account" || account.Doc == nil || account.Doc.Text != "The customer placing the order." {
+		t.Errorf("unexpected association method: %+v %+v", account, account.Doc)
+	}
+	if r := account.Range(); r.Start.Line != 2 || r.Start.Character != 13 {
+		t.Errorf("expected the method to point at the DSL call: %+v", r.Start)
+	}
+}
+
+func TestSchemaColumns(t *testing.T) {
+	i := New("./testdata/rails")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		owner, name, returns string
+		line                 int
+		doc                  string
+	}{
+		{"Order", "id", "Integer", 1, "Column `id` of table `orders`: bigint, not null."},
+		{"Order", "account_id", "Integer", 2, "Column `account_id` of table `orders`: bigint, not null."},
+		{"Order", "reference", "String", 3, "Column `reference` of table `orders`: string, not null."},
+		{"Order", "total", "BigDecimal?", 4, "Column `total` of table `orders`: decimal, nullable."},
+		{"Order", "gift?", "bool", 5, ""},
+		{"Order", "created_at", "ActiveSupport::TimeWithZone", 6, ""},
+		{"LineItem", "id", "String", 10, ""},
+		{"LineItem", "quantity=", "Integer", 11, ""},
+		{"Shipment", "id", "Integer", 1, ""},
+		{"Shipment", "carrier", "String", 2, "Column `carrier` of table `shipments`: string, not null."},
+		{"Shipment", "weight", "BigDecimal?", 3, ""},
+		{"Shipment", "delivered_at", "ActiveSupport::TimeWithZone?", 4, ""},
+	}
+	for _, tt := range tests {
+		var found *MethodDecl
+		for _, m := range i.MethodsOf(tt.owner, false) {
+			if m.Name == tt.name {
+				found = m
+			}
+		}
+		if found == nil {
+			t.Errorf("%s#%s not declared", tt.owner, tt.name)
+			continue
+		}
+		if found.Types[0].Return != tt.returns || found.Range().Start.Line != tt.line {
+			t.Errorf("%s: unexpected type %s or line %d", found.FullName(), found.Types[0].Return, found.Range().Start.Line)
+		}
+		if tt.doc != "" && found.Doc.Text != tt.doc {
+			t.Errorf("%s: unexpected doc %q", found.FullName(), found.Doc.Text)
+		}
+	}
+	for _, m := range i.MethodsOf("Shipment", false) {
+		if strings.HasPrefix(m.Name, "weight_positive") {
+			t.Errorf("constraint indexed as a column: %s", m.Name)
+		}
+	}
+
+	// Dumps may use CRLF line endings and carry lines longer than a
+	// bufio.Scanner token.
+	path := filepath.Join(t.TempDir(), "structure.sql")
+	dump := "-- " + strings.Repeat("x", 70000) + "\r\nCREATE TABLE public.parcels (\r\n    id bigint NOT NULL,\r\n    label text\r\n);\r\n"
+	if err := os.WriteFile(path, []byte(dump), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sql := &Index{}
+	if err := sql.indexStructureSQL(path); err != nil {
+		t.Fatal(err)
+	}
+	var label *MethodDecl
+	for k := range sql.MethodDecls {
+		if sql.MethodDecls[k].Name == "label" {
+			label = &sql.MethodDecls[k]
+		}
+	}
+	if label == nil || label.Range().Start.Line != 3 || label.Range().Start.Character != 4 {
+		t.Errorf("unexpected label column: %+v", label)
+	}
+}
+
+func TestSpecSymbols(t *testing.T) {
+	src, err := os.ReadFile("./testdata/spec/invoice_spec.rb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols, err := DocumentSymbols("./testdata/spec/invoice_spec.rb", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var walk func(symbols []*Symbol, depth int)
+	walk = func(symbols []*Symbol, depth int) {
+		for _, s := range symbols {
+			got = append(got, fmt.Sprintf("%s%s %s %q", strings.Repeat("  ", depth), s.Detail, s.Name, src[s.NameStart:s.NameEnd]))
+			walk(s.Children, depth+1)
+		}
+	}
+	walk(symbols, 0)
+	want := []string{
+		`describe Invoice "Invoice"`,
+		`  let invoice "invoice"`,
+		`  subject subject ""`,
+		`  describe #total "\"#total\""`,
+		`    let! invoice "invoice"`,
+		`    before before ""`,
+		`    it sums the lines "\"sums the lines\""`,
+		`    context when empty "\"when empty\""`,
+		`      it it ""`,
+		`  it_behaves_like a payable "\"a payable\""`,
+		`   helper "helper"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected outline:\n%s", strings.Join(got, "\n"))
+	}
+
+	dsl := []byte("describe \"cli\" do\nend\nit \"is pending\"\n")
+	if symbols, _ := DocumentSymbols("lib/cli.rb", dsl); len(symbols) != 0 {
+		t.Errorf("spec symbols outside spec files: %+v", symbols)
+	}
+	if symbols, _ := DocumentSymbols("spec/cli_spec.rb", dsl); len(symbols) != 1 {
+		t.Errorf("examples without a block are not symbols: %+v", symbols)
+	}
+
+	lines := NewLineIndex(src)
+	for _, tt := range []struct{ line, column, defLine int }{
+		{10, 15, 5},
+		{14, 18, 5},
+		{2, 14, 1},
+		{18, 2, 1},
+	} {
+		let := LetAt(symbols, "invoice", lines.Offset(tt.line, tt.column))
+		if let == nil || lines.Line(let.NameStart) != tt.defLine {
+			t.Errorf("invoice at %d:%d resolved to %+v, want the let on line %d", tt.line, tt.column, let, tt.defLine)
+		}
+	}
+
+	i := New("./testdata/spec")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	ranges, ok := i.LookupSharedGroup("a payable")
+	if !ok || ranges[0].Start.FileURI != "testdata/spec/support/payable.rb" || ranges[0].Start.Character != 23 {
+		t.Fatalf("unexpected shared group definition: %+v", ranges)
+	}
+	refs := i.ReferencesTo("a payable", RefSharedGroup)
+	if len(refs) != 1 || refs[0].Range().Start.Line != 18 || refs[0].Range().Start.Character != 19 {
+		t.Fatalf("unexpected shared group references: %+v", refs)
+	}
+}
+
+func TestRakeTasks(t *testing.T) {
+	i := New("./testdata/rake")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, task := range i.Tasks {
+		got = append(got, fmt.Sprintf("%s %q %v %d:%d", task.Name, task.Description, task.Prerequisites, task.r.Start.Line, task.r.Start.Character))
+	}
+	want := []string{
+		`environment "" [] 0:6`,
+		`default "Run the test suite" [environment db:seed:demo] 3:5`,
+		`.o "" [.c] 5:6`,
+		`db:reset "Reset the database" [environment] 2:7`,
+		`db:seed:demo "Load demo data" [reset ^reset] 6:10`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected tasks:\n%s", strings.Join(got, "\n"))
+	}
+	for _, tt := range []struct{ name, namespace, want string }{
+		{"reset", "db:seed", "db:reset"},
+		{"^reset", "db:seed", "db:reset"},
+		{"environment", "db", "environment"},
+		{"rake:environment", "db", "environment"},
+		{"db:seed:demo", "", "db:seed:demo"},
+	} {
+		ranges, ok := i.LookupTask(tt.name, tt.namespace)
+		if !ok {
+			t.Errorf("LookupTask(%s, %s) found nothing", tt.name, tt.namespace)
+			continue
+		}
+		if tasks := i.table().tasks[tt.want]; tasks[0].r != ranges[0] {
+			t.Errorf("LookupTask(%s, %s) = %+v, want %s", tt.name, tt.namespace, ranges[0].Start, tt.want)
+		}
+	}
+	if _, ok := i.LookupTask("seed", ""); ok {
+		t.Errorf("namespaces are not tasks")
+	}
+	results := i.Search("SEED", 10)
+	if len(results) != 1 || results[0].(*RakeTask).Name != "db:seed:demo" {
+		t.Errorf("unexpected search results: %+v", results)
+	}
+
+	src, err := os.ReadFile("./testdata/rake/lib/tasks/db.rake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbols, err := DocumentSymbols("./testdata/rake/lib/tasks/db.rake", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := symbols[0].Children[1]
+	if len(symbols) != 1 || symbols[0].Children[0].Detail != "Reset the database" || seed.Name != "seed" ||
+		seed.Children[0].Name != "demo" || seed.Children[0].Detail != "Load demo data" {
+		t.Fatalf("unexpected outline: %+v %+v", symbols[0], seed)
+	}
+	lines := NewLineIndex(src)
+	if ns := RakeNamespaceAt(symbols, lines.Offset(7, 20)); ns != "db:seed" {
+		t.Errorf("unexpected namespace: %s", ns)
+	}
+	routes := []byte("Rails.application.routes.draw do\n  namespace :admin do\n    resources :users\n  end\n  desc \"x\"\n  task :sync\nend\n")
+	if symbols, _ := DocumentSymbols("config/routes.rb", routes); len(symbols) != 0 {
+		t.Errorf("Rake symbols outlined outside a Rake file: %+v", symbols[0])
+	}
+}
+
+func TestGeneratedMethods(t *testing.T) {
+	i := New("./testdata/meta")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	describe := func(owner string, singleton bool) string {
+		var got []string
+		for _, m := range i.MethodsOf(owner, singleton) {
+			entry := m.Name + "(" + strings.Join(m.Args, ", ") + ")"
+			if m.Synthetic() {
+				entry += fmt.Sprintf(" %d:%d<-%d:%d", m.r.Start.Line, m.r.Start.Character, m.Generator.Start.Line, m.Generator.Start.Character)
+			}
+			got = append(got, entry)
+		}
+		return strings.Join(got, " ")
+	}
+	for _, tt := range []struct {
+		owner     string
+		singleton bool
+		want      string
+	}{
+		{"Shapes::Point", false, "x() 1:22<-1:10 x=(value) 1:22<-1:10 y() 1:26<-1:10 y=(value) 1:26<-1:10 distance()"},
+		{"Shapes::Point", true, "new(x, y) 1:10<-1:10"},
+		{"Shapes::Coord", false, "lat() 5:23<-5:10 lng() 5:29<-5:10"},
+		{"Shapes::Size", false, "width() 7:27<-7:15 width=(value) 7:27<-7:15 height() 7:35<-7:15 height=(value) 7:35<-7:15"},
+		{"Shapes::Invoice", false, "draft?() 13:7<-14:6 sent?() 13:13<-14:6 mark_draft!(at) 13:7<-15:6 mark_sent!(at) 13:13<-15:6 total() 18:19<-18:4"},
+		{"Shapes::Invoice", true, "build(attrs) 19:29<-19:4"},
+	} {
+		if got := describe(tt.owner, tt.singleton); got != tt.want {
+			t.Errorf("methods of %s (singleton %t):\n got %s\nwant %s", tt.owner, tt.singleton, got, tt.want)
+		}
+	}
+	if ancestors := i.Ancestors("Shapes::Coord"); len(ancestors) < 2 || ancestors[1] != "Data" {
+		t.Errorf("unexpected ancestors: %v", ancestors)
+	}
+	if constants := i.Constants("Point"); len(constants) != 1 || constants[0].Type() != NodeClass {
+		t.Errorf("expected Point to be indexed as a class: %+v", constants)
+	}
+}
+
+func TestResolveConstant(t *testing.T) {
+	i := New("./testdata/nesting")
+	i.Builtins = Core()
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		path    string
+		nesting []string
+		want    string
+	}{
+		{"Error", []string{"Payments"}, "Payments::Error"},
+		{"Error", nil, "Error"},
+		{"::Error", []string{"Payments"}, "Error"},
+		{"Error", []string{"Payments::Charge", "Payments"}, "Payments::Error"},
+		// class Payments::Refund does not put Payments in the nesting.
+		{"Error", []string{"Payments::Refund"}, "Error"},
+		{"RETRIES", []string{"Payments::Charge", "Payments"}, "Payments::Gateway::Base::RETRIES"},
+		{"Gateway::TIMEOUT", []string{"Payments::Charge", "Payments"}, "Payments::Gateway::TIMEOUT"},
+		{"Payments::Gateway::Base", nil, "Payments::Gateway::Base"},
+		{"StandardError", []string{"Payments"}, "StandardError"},
+	} {
+		got, nodes, ok := i.ResolveConstant(tt.path, tt.nesting)
+		if !ok || got != tt.want {
+			t.Errorf("ResolveConstant(%s, %v) = %q, %t, want %q", tt.path, tt.nesting, got, ok, tt.want)
+			continue
+		}
+		if tt.want != "StandardError" && len(nodes) != 1 {
+			t.Errorf("ResolveConstant(%s, %v) = %d declarations, want 1", tt.path, tt.nesting, len(nodes))
+		}
+	}
+	for _, path := range []string{"Gateway::Missing", "Missing", "Payments::TIMEOUT"} {
+		if got, _, ok := i.ResolveConstant(path, []string{"Payments"}); ok {
+			t.Errorf("ResolveConstant(%s) = %q, want no match", path, got)
+		}
+	}
+}
+
+func TestTypeAt(t *testing.T) {
+	i := New("./testdata/types")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	src := `module Billing
+  class Report
+    def run(limit = 10)
+      invoice = Invoice.find(1)
+      other = Billing::Invoice.new
+      label ||= "draft"
+      customer = invoice.customer
+      @invoice = other
+      invoice
+      other
+      label
+      limit
+      customer
+      customer.name
+      invoice.total
+      @invoice
+      self
+      Invoice
+      (other)
+      unknown
+    end
+  end
+end
+`
+	for _, tt := range []struct {
+		expr string
+		want string
+	}{
+		{"invoice", "Billing::Invoice"},
+		{"other", "Billing::Invoice"},
+		{"label", "String"},
+		{"limit", "Integer"},
+		{"customer", "Billing::Customer NilClass"},
+		{"customer.name", "String"},
+		{"invoice.total", "Billing::Money"},
+		{"@invoice", "Billing::Invoice"},
+		{"self", "Billing::Report"},
+		{"Invoice", "singleton(Billing::Invoice)"},
+		{"(other)", "Billing::Invoice"},
+		{"unknown", ""},
+	} {
+		offset := strings.Index(src, "\n      "+tt.expr+"\n") + len("\n      "+tt.expr)
+		var got []string
+		for _, typ := range i.TypeAt([]byte(src), offset) {
+			got = append(got, typ.String())
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("TypeAt(%s) = %v, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestMethodsOn(t *testing.T) {
+	i := New("./testdata/types")
+	i.Builtins = Core()
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	names := func(t Type) map[string]bool {
+		res := make(map[string]bool)
+		for _, m := range i.MethodsOn(t) {
+			res[m.Name] = true
+		}
+		return res
+	}
+	instance := names(Type{Name: "Billing::Invoice"})
+	if !instance["customer"] || !instance["total"] || instance["find"] || !instance["frozen?"] {
+		t.Errorf("unexpected instance methods: %v", instance)
+	}
+	singleton := names(Type{Name: "Billing::Invoice", Singleton: true})
+	if !singleton["find"] || !singleton["where"] || !singleton["new"] || singleton["customer"] {
+		t.Errorf("unexpected class methods: %v", singleton)
+	}
+	if got := i.MethodsFor(Type{Name: "Billing::Invoice", Singleton: true}, "where"); len(got) != 1 || got[0].Owner != "Finders" {
+		t.Errorf("MethodsFor(Invoice, where) = %v", got)
+	}
+	var members []string
+	for _, n := range i.ConstantsIn("Billing") {
+		members = append(members, qualifiedName(n))
+	}
+	if strings.Join(members, " ") != "Billing::Customer Billing::Invoice Billing::Money" {
+		t.Errorf("ConstantsIn(Billing) = %v", members)
+	}
+	// Completion asks while the call is still being typed.
+	src := "module Billing\n  invoice = Invoice.find(1)\n  invoice.\nend\n"
+	offset := strings.Index(src, "invoice.\n") + len("invoice")
+	if got := i.TypeAt([]byte(src), offset); len(got) != 1 || got[0].Name != "Billing::Invoice" {
+		t.Errorf("TypeAt(invoice.) = %v", got)
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	i := New("./testdata/types")
+	if err := i.Start(log.Default()); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, singleton := range []bool{false, true} {
+		for _, m := range i.MethodsOf("Ledger", singleton) {
+			got = append(got, fmt.Sprintf("%s:%d", m.Name, m.Visibility))
+		}
+	}
+	want := "balance:0 reconcile:2 entries:1 audit:2 export:0 open:0 load:0 cache:2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("visibility = %s, want %s", strings.Join(got, " "), want)
+	}
+}
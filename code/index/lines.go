@@ -0,0 +1,96 @@
+package index
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// LineIndex converts between byte offsets into a file and LSP positions,
+// whose characters count UTF-16 code units. It keeps the offset at which
+// every line starts, so a conversion costs a binary search plus a scan of
+// a single line.
+type LineIndex struct {
+	src    []byte
+	starts []int
+}
+
+func NewLineIndex(src []byte) *LineIndex {
+	starts := []int{0}
+	for k, b := range src {
+		if b == '\n' {
+			starts = append(starts, k+1)
+		}
+	}
+	return &LineIndex{src: src, starts: starts}
+}
+
+// Line returns the zero based line containing offset.
+func (l *LineIndex) Line(offset int) int {
+	return sort.Search(len(l.starts), func(k int) bool {
+		return l.starts[k] > offset
+	}) - 1
+}
+
+// Position returns the line and UTF-16 character of offset, which is
+// clamped to the file.
+func (l *LineIndex) Position(offset int) (line, character int) {
+	offset = max(0, min(offset, len(l.src)))
+	line = l.Line(offset)
+	return line, utf16Len(l.src[l.starts[line]:offset])
+}
+
+// Offset returns the byte offset of the given line and UTF-16 character.
+// Positions past the end of a line resolve to its end, and lines past the
+// end of the file to the end of the file.
+func (l *LineIndex) Offset(line, character int) int {
+	if line < 0 {
+		return 0
+	}
+	if line >= len(l.starts) {
+		return len(l.src)
+	}
+	offset := l.starts[line]
+	for units := 0; offset < len(l.src) && l.src[offset] != '\n' && units < character; {
+		r, size := utf8.DecodeRune(l.src[offset:])
+		units += utf16Units(r)
+		offset += size
+	}
+	return offset
+}
+
+// Column returns the byte column of the given line and UTF-16 character,
+// which is what tree-sitter points use.
+func (l *LineIndex) Column(line, character int) int {
+	offset := l.Offset(line, character)
+	if line >= len(l.starts) {
+		line = len(l.starts) - 1
+	}
+	return offset - l.starts[max(line, 0)]
+}
+
+// Character converts a byte column on line back to UTF-16 code units.
+func (l *LineIndex) Character(line, column int) int {
+	if line < 0 || line >= len(l.starts) {
+		return 0
+	}
+	start := l.starts[line]
+	end := min(start+column, len(l.src))
+	return utf16Len(l.src[start:end])
+}
+
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		n += utf16Units(r)
+		b = b[size:]
+	}
+	return n
+}
+
+func utf16Units(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
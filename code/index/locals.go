@@ -0,0 +1,234 @@
+package index
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// documentParser parses open documents, which are analysed outside of
+// indexing.
+var documentParser struct {
+	sync.Mutex
+	p *parser.Parser
+}
+
+func parseDocument(src []byte) (*parser.ParseResult, error) {
+	documentParser.Lock()
+	defer documentParser.Unlock()
+	if documentParser.p == nil {
+		p, err := parser.NewParser(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		documentParser.p = p
+	}
+	return documentParser.p.Parse(context.Background(), src)
+}
+
+type LocalKind int
+
+const (
+	LocalAssigned LocalKind = iota
+	LocalParam
+	// LocalBlockLocal is a block-local variable, `x` in `|a; x|`.
+	LocalBlockLocal
+	// LocalImplicit is a numbered block parameter or `it`.
+	LocalImplicit
+)
+
+// LocalVar is a local variable, defined where it is first assigned or
+// bound. Start and End are the byte offsets of its name there.
+type LocalVar struct {
+	Name       string
+	Kind       LocalKind
+	Start, End int
+}
+
+// LocalScope is a local variable scope: the program, a class or module
+// body, a method or a block. Blocks see the locals of the scopes around
+// them, the others do not.
+type LocalScope struct {
+	Parent   *LocalScope
+	Children []*LocalScope
+	Locals   []*LocalVar
+	hard     bool
+	start    int
+	end      int
+}
+
+// Locals parses src and returns its outermost local variable scope.
+func Locals(src []byte) (*LocalScope, error) {
+	result, err := parseDocument(src)
+	if err != nil {
+		return nil, err
+	}
+	return AnalyzeLocals(result.Value), nil
+}
+
+func AnalyzeLocals(root parser.Node) *LocalScope {
+	s := &LocalScope{hard: true, end: math.MaxInt}
+	s.walk(root)
+	return s
+}
+
+func (s *LocalScope) child(loc *parser.Location, hard bool) *LocalScope {
+	c := &LocalScope{Parent: s, hard: hard, start: int(loc.StartOffset), end: int(loc.EndOffset())}
+	s.Children = append(s.Children, c)
+	return c
+}
+
+// define binds a new local in s, shadowing any visible one.
+func (s *LocalScope) define(name string, kind LocalKind, loc *parser.Location) {
+	if name == "" || loc == nil {
+		return
+	}
+	start := int(loc.StartOffset)
+	s.Locals = append(s.Locals, &LocalVar{Name: name, Kind: kind, Start: start, End: start + len(name)})
+}
+
+// assign binds name in s unless an assignment already made it visible.
+func (s *LocalScope) assign(name string, loc *parser.Location) {
+	for sc := s; sc != nil; sc = sc.Parent {
+		for _, l := range sc.Locals {
+			if l.Name == name {
+				return
+			}
+		}
+		if sc.hard {
+			break
+		}
+	}
+	s.define(name, LocalAssigned, loc)
+}
+
+func (s *LocalScope) walk(node parser.Node) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *parser.ClassNode:
+		s.walk(n.Constantpath)
+		s.walk(n.Superclass)
+		s.child(n.Loc, true).walk(n.Body)
+		return
+	case *parser.ModuleNode:
+		s.walk(n.Constantpath)
+		s.child(n.Loc, true).walk(n.Body)
+		return
+	case *parser.SingletonClassNode:
+		s.walk(n.Expression)
+		s.child(n.Loc, true).walk(n.Body)
+		return
+	case *parser.DefNode:
+		s.walk(n.Receiver)
+		inner := s.child(n.Loc, true)
+		if n.Parameters != nil {
+			inner.walk(n.Parameters)
+		}
+		inner.walk(n.Body)
+		return
+	case *parser.BlockNode:
+		s.child(n.Loc, false).walkBlock(n.Parameters, n.Body, n.Openingloc)
+		return
+	case *parser.LambdaNode:
+		s.child(n.Loc, false).walkBlock(n.Parameters, n.Body, n.Openingloc)
+		return
+	case *parser.RequiredParameterNode:
+		s.define(n.Name, LocalParam, n.Loc)
+	case *parser.OptionalParameterNode:
+		s.define(n.Name, LocalParam, n.Nameloc)
+	case *parser.RequiredKeywordParameterNode:
+		s.define(n.Name, LocalParam, n.Nameloc)
+	case *parser.OptionalKeywordParameterNode:
+		s.define(n.Name, LocalParam, n.Nameloc)
+	case *parser.RestParameterNode:
+		if n.Name != nil {
+			s.define(*n.Name, LocalParam, n.Nameloc)
+		}
+	case *parser.KeywordRestParameterNode:
+		if n.Name != nil {
+			s.define(*n.Name, LocalParam, n.Nameloc)
+		}
+	case *parser.BlockParameterNode:
+		if n.Name != nil {
+			s.define(*n.Name, LocalParam, n.Nameloc)
+		}
+	case *parser.BlockLocalVariableNode:
+		s.define(n.Name, LocalBlockLocal, n.Loc)
+	case *parser.LocalVariableWriteNode:
+		s.assign(n.Name, n.Nameloc)
+	case *parser.LocalVariableOrWriteNode:
+		s.assign(n.Name, n.Nameloc)
+	case *parser.LocalVariableAndWriteNode:
+		s.assign(n.Name, n.Nameloc)
+	case *parser.LocalVariableOperatorWriteNode:
+		s.assign(n.Name, n.Nameloc)
+	case *parser.LocalVariableTargetNode:
+		// Multiple assignment, for loops, rescue bindings and pattern
+		// captures all bind through targets.
+		s.assign(n.Name, n.Loc)
+	}
+	for _, child := range node.Children() {
+		s.walk(child)
+	}
+}
+
+func (s *LocalScope) walkBlock(params, body parser.Node, opening *parser.Location) {
+	switch p := params.(type) {
+	case *parser.NumberedParametersNode:
+		for k := 1; k <= int(p.Maximum); k++ {
+			s.define("_"+strconv.Itoa(k), LocalImplicit, opening)
+		}
+	case *parser.ItParametersNode:
+		s.define("it", LocalImplicit, opening)
+	default:
+		s.walk(params)
+	}
+	s.walk(body)
+}
+
+// Innermost returns the innermost scope containing offset.
+func (s *LocalScope) Innermost(offset int) *LocalScope {
+	for _, c := range s.Children {
+		if c.start <= offset && offset <= c.end {
+			return c.Innermost(offset)
+		}
+	}
+	return s
+}
+
+// Lookup returns the local named name visible at offset, if any.
+func (s *LocalScope) Lookup(name string, offset int) *LocalVar {
+	for sc := s.Innermost(offset); sc != nil; sc = sc.Parent {
+		for _, l := range sc.Locals {
+			if l.Name == name && l.Start <= offset {
+				return l
+			}
+		}
+		if sc.hard {
+			break
+		}
+	}
+	return nil
+}
+
+// Visible returns the locals visible at offset, innermost scope first.
+func (s *LocalScope) Visible(offset int) []*LocalVar {
+	var res []*LocalVar
+	seen := make(map[string]bool)
+	for sc := s.Innermost(offset); sc != nil; sc = sc.Parent {
+		for _, l := range sc.Locals {
+			if !seen[l.Name] && l.Start < offset {
+				seen[l.Name] = true
+				res = append(res, l)
+			}
+		}
+		if sc.hard {
+			break
+		}
+	}
+	return res
+}
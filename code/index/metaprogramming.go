@@ -0,0 +1,233 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// span converts a node location into a range.
+func (f *sourceFile) span(loc *parser.Location) (*Range, error) {
+	start, err := f.location(int(loc.StartOffset))
+	if err != nil {
+		return nil, err
+	}
+	end, err := f.location(int(loc.EndOffset()))
+	if err != nil {
+		return nil, err
+	}
+	return &Range{Start: start, End: end}, nil
+}
+
+// structCall recognises `Struct.new(...)` and `Data.define(...)`, returning
+// the class the call creates a subclass of.
+func structCall(node parser.Node) (string, *parser.CallNode, bool) {
+	call, ok := node.(*parser.CallNode)
+	if !ok {
+		return "", nil, false
+	}
+	switch receiver := strings.TrimPrefix(constantPath(call.Receiver), "::"); {
+	case receiver == "Struct" && call.Name == "new", receiver == "Data" && call.Name == "define":
+		return receiver, call, true
+	}
+	return "", nil, false
+}
+
+// indexStruct indexes `Point = Struct.new(:x, :y)` as a class with the
+// members' accessors, and the methods defined in the call's block.
+func (i *Index) indexStruct(node *parser.ConstantWriteNode, call *parser.CallNode, superclass string, file *sourceFile, sc scope) error {
+	r, err := file.span(node.Loc)
+	if err != nil {
+		return err
+	}
+	cls := ClassDecl{
+		Name:       node.Name,
+		Owner:      sc.namespace,
+		Superclass: superclass,
+		Doc:        file.comments.docAbove(r.Start.Line),
+		r:          r,
+	}
+	i.ClassDecls = append(i.ClassDecls, cls)
+	if err := i.structMembers(call, superclass, cls.FullName(), file); err != nil {
+		return err
+	}
+	if block, ok := call.Block.(*parser.BlockNode); ok {
+		return i.indexProgram(block.Body, file, scope{namespace: cls.FullName()})
+	}
+	return nil
+}
+
+// structMembers declares the constructor and member accessors of a struct
+// on owner. Data members are read only.
+func (i *Index) structMembers(call *parser.CallNode, superclass, owner string, file *sourceFile) error {
+	if call.Arguments == nil {
+		return nil
+	}
+	generator, err := file.span(call.Loc)
+	if err != nil {
+		return err
+	}
+	signature := firstLine(string(file.src[call.Loc.StartOffset:call.Loc.EndOffset()]))
+	var members []string
+	for _, arg := range call.Arguments.Arguments {
+		sym, ok := arg.(*parser.SymbolNode)
+		if !ok {
+			continue
+		}
+		r, err := file.span(nameLocation(sym))
+		if err != nil {
+			return err
+		}
+		members = append(members, sym.Unescaped)
+		i.MethodDecls = append(i.MethodDecls, MethodDecl{Name: sym.Unescaped, Owner: owner, Signature: signature, Generator: generator, r: r})
+		if superclass == "Struct" {
+			i.MethodDecls = append(i.MethodDecls, MethodDecl{Name: sym.Unescaped + "=", Owner: owner, Signature: signature, Args: []string{"value"}, Generator: generator, r: r})
+		}
+	}
+	i.MethodDecls = append(i.MethodDecls, MethodDecl{Name: "new", Owner: owner, Singleton: true, Signature: signature, Args: members, Generator: generator, r: generator})
+	return nil
+}
+
+// iteration is the block parameter of an `each` over literal names and
+// the names it takes.
+type iteration struct {
+	param  string
+	values []parser.Node
+}
+
+// indexIteratedDefines expands `%i[draft sent].each { |s| define_method(...) }`
+// in a class body.
+func (i *Index) indexIteratedDefines(node *parser.CallNode, file *sourceFile, sc scope) error {
+	array, ok := node.Receiver.(*parser.ArrayNode)
+	if !ok || node.Name != "each" {
+		return nil
+	}
+	block, ok := node.Block.(*parser.BlockNode)
+	if !ok || block.Body == nil {
+		return nil
+	}
+	params := blockParams(block.Parameters)
+	if len(params) != 1 {
+		return nil
+	}
+	iter := &iteration{param: params[0]}
+	for _, element := range array.Elements {
+		if literalName(element) == "" {
+			return nil
+		}
+		iter.values = append(iter.values, element)
+	}
+	for _, stmt := range block.Body.Children() {
+		if call, ok := stmt.(*parser.CallNode); ok && call.Receiver == nil {
+			if err := i.indexDefineMethod(call, file, sc, iter); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexDefineMethod indexes a define_method call whose name is a literal
+// or, within an iteration, built from the iterated names.
+func (i *Index) indexDefineMethod(node *parser.CallNode, file *sourceFile, sc scope, iter *iteration) error {
+	if node.Name != "define_method" && node.Name != "define_singleton_method" || node.Arguments == nil {
+		return nil
+	}
+	arg := node.Arguments.Arguments[0]
+	type definition struct {
+		name string
+		at   parser.Node
+	}
+	var defs []definition
+	if name := literalName(arg); name != "" {
+		defs = append(defs, definition{name, arg})
+	} else if iter != nil {
+		for _, value := range iter.values {
+			name, ok := iteratedName(arg, iter.param, literalName(value))
+			if !ok {
+				return nil
+			}
+			defs = append(defs, definition{name, value})
+		}
+	}
+	if len(defs) == 0 {
+		return nil
+	}
+	generator, err := file.span(node.Loc)
+	if err != nil {
+		return err
+	}
+	signature := firstLine(string(file.src[node.Loc.StartOffset:node.Loc.EndOffset()]))
+	var args []string
+	if block, ok := node.Block.(*parser.BlockNode); ok {
+		args = blockParams(block.Parameters)
+	}
+	for _, d := range defs {
+		r, err := file.span(nameLocation(d.at))
+		if err != nil {
+			return err
+		}
+		i.MethodDecls = append(i.MethodDecls, MethodDecl{
+			Name:      d.name,
+			Owner:     sc.namespace,
+			Singleton: sc.singleton || node.Name == "define_singleton_method",
+			Signature: signature,
+			Args:      args,
+			Doc:       file.comments.docAbove(generator.Start.Line),
+			Generator: generator,
+			r:         r,
+		})
+	}
+	return nil
+}
+
+// iteratedName evaluates a method name that is the iteration parameter or
+// a string or symbol interpolating it, such as `"#{s}?"`.
+func iteratedName(node parser.Node, param, value string) (string, bool) {
+	var parts []parser.Node
+	switch n := node.(type) {
+	case *parser.LocalVariableReadNode:
+		return value, n.Name == param
+	case *parser.InterpolatedStringNode:
+		parts = n.Parts
+	case *parser.InterpolatedSymbolNode:
+		parts = n.Parts
+	default:
+		return "", false
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		switch p := part.(type) {
+		case *parser.StringNode:
+			b.WriteString(p.Unescaped)
+		case *parser.EmbeddedStatementsNode:
+			if p.Statements == nil || len(p.Statements.Body) != 1 {
+				return "", false
+			}
+			read, ok := p.Statements.Body[0].(*parser.LocalVariableReadNode)
+			if !ok || read.Name != param {
+				return "", false
+			}
+			b.WriteString(value)
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// blockParams returns the names of the required parameters of a block or
+// lambda.
+func blockParams(node parser.Node) []string {
+	params, ok := node.(*parser.BlockParametersNode)
+	if !ok || params.Parameters == nil {
+		return nil
+	}
+	var names []string
+	for _, p := range params.Parameters.Requireds {
+		if r, ok := p.(*parser.RequiredParameterNode); ok {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
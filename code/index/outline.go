@@ -0,0 +1,153 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+type SymbolKind int
+
+const (
+	SymbolModule SymbolKind = iota
+	SymbolClass
+	SymbolMethod
+	SymbolConstant
+	// SymbolExampleGroup is an RSpec describe or context block, or an
+	// included shared group.
+	SymbolExampleGroup
+	SymbolExample
+	// SymbolLet is a let, let! or subject definition.
+	SymbolLet
+	SymbolHook
+	SymbolSharedGroup
+	// SymbolNamespace is a Rake namespace.
+	SymbolNamespace
+	SymbolTask
+)
+
+// Symbol is an entry of a document's outline. Start and End span the
+// declaration and NameStart and NameEnd its name, as byte offsets.
+type Symbol struct {
+	Name   string
+	Detail string
+	Kind   SymbolKind
+	Start  int
+	End    int
+	// NameStart and NameEnd equal Start when the declaration is unnamed,
+	// like `it { ... }`.
+	NameStart int
+	NameEnd   int
+	Children  []*Symbol
+}
+
+// DocumentSymbols parses src, the contents of the file at path, and returns
+// its outline: classes, modules, methods and constants, along with the
+// RSpec groups, examples and lets of spec files and the namespaces and
+// tasks of Rake files.
+func DocumentSymbols(path string, src []byte) ([]*Symbol, error) {
+	result, err := parseDocument(src)
+	if err != nil {
+		return nil, err
+	}
+	return outline(result.Value, src, dialects{spec: IsSpecFile(path), rake: IsRakeFile(path)}), nil
+}
+
+// dialects says which DSLs are outlined in a file: RSpec in spec files and
+// Rake in Rake files, as the same calls mean other things elsewhere.
+type dialects struct {
+	spec, rake bool
+}
+
+func outline(node parser.Node, src []byte, dsl dialects) []*Symbol {
+	var res []*Symbol
+	// desc describes the Rake task that follows it.
+	var desc string
+	for _, child := range node.Children() {
+		if child == nil {
+			continue
+		}
+		if call, ok := child.(*parser.CallNode); ok && dsl.rake {
+			if d, ok := rakeDesc(call); ok {
+				desc = d
+				continue
+			}
+		}
+		if s := outlineSymbol(child, src, dsl); s != nil {
+			if s.Kind == SymbolTask && desc != "" {
+				s.Detail = desc
+			}
+			desc = ""
+			res = append(res, s)
+			continue
+		}
+		res = append(res, outline(child, src, dsl)...)
+	}
+	return res
+}
+
+// outlineSymbol returns the symbol node declares, with its children, or
+// nil if it declares none.
+func outlineSymbol(node parser.Node, src []byte, dsl dialects) *Symbol {
+	switch n := node.(type) {
+	case *parser.ClassNode:
+		s := newSymbol(constantPath(n.Constantpath), SymbolClass, n.Loc, n.Constantpath.Location())
+		if n.Body != nil {
+			s.Children = outline(n.Body, src, dsl)
+		}
+		return s
+	case *parser.ModuleNode:
+		s := newSymbol(constantPath(n.Constantpath), SymbolModule, n.Loc, n.Constantpath.Location())
+		if n.Body != nil {
+			s.Children = outline(n.Body, src, dsl)
+		}
+		return s
+	case *parser.DefNode:
+		name := n.Name
+		if _, ok := n.Receiver.(*parser.SelfNode); ok {
+			name = "self." + name
+		}
+		return newSymbol(name, SymbolMethod, n.Loc, n.Nameloc)
+	case *parser.ConstantWriteNode:
+		return newSymbol(n.Name, SymbolConstant, n.Loc, n.Nameloc)
+	case *parser.CallNode:
+		if dsl.spec {
+			if s := specSymbol(n, src); s != nil {
+				return s
+			}
+		}
+		if dsl.rake {
+			return rakeSymbol(n, src, dsl)
+		}
+	}
+	return nil
+}
+
+func newSymbol(name string, kind SymbolKind, loc, nameLoc *parser.Location) *Symbol {
+	s := &Symbol{Name: name, Kind: kind, Start: int(loc.StartOffset), End: int(loc.EndOffset())}
+	s.NameStart, s.NameEnd = s.Start, s.Start
+	if nameLoc != nil {
+		s.NameStart, s.NameEnd = int(nameLoc.StartOffset), int(nameLoc.EndOffset())
+	}
+	return s
+}
+
+// description joins the arguments of an RSpec call the way RSpec names the
+// group or example.
+func description(args []parser.Node, src []byte) string {
+	var parts []string
+	for _, arg := range args {
+		switch a := arg.(type) {
+		case *parser.StringNode:
+			parts = append(parts, a.Unescaped)
+		case *parser.SymbolNode:
+			parts = append(parts, a.Unescaped)
+		case *parser.KeywordHashNode:
+			// Metadata such as `type: :model` is not part of the name.
+		default:
+			loc := arg.Location()
+			parts = append(parts, string(src[loc.StartOffset:loc.EndOffset()]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
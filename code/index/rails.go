@@ -0,0 +1,172 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// indexDSL expands the ActiveRecord class body calls that define methods,
+// associations, scopes and delegations, into the methods they define.
+func (i *Index) indexDSL(node *parser.CallNode, file *sourceFile, sc scope) error {
+	if sc.singleton {
+		return nil
+	}
+	args := node.Arguments.Arguments
+	options := dslOptions(args)
+	signature := dslSignature(node, file)
+	generator, err := file.span(node.Loc)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		sym, ok := arg.(*parser.SymbolNode)
+		if !ok {
+			continue
+		}
+		name := sym.Unescaped
+		startLoc, err := file.location(int(arg.Location().StartOffset))
+		if err != nil {
+			return err
+		}
+		endLoc, err := file.location(int(arg.Location().EndOffset()))
+		if err != nil {
+			return err
+		}
+		doc := file.comments.docAbove(startLoc.Line)
+		add := func(method string, singleton bool, args []string, returns string) {
+			m := MethodDecl{Name: method, Owner: sc.namespace, Singleton: singleton, Signature: signature, Args: args, Doc: doc, Generator: generator, r: &Range{Start: startLoc, End: endLoc}}
+			if returns != "" {
+				var params []string
+				for _, a := range args {
+					if name, _, optional := strings.Cut(a, " = "); optional {
+						params = append(params, "?untyped "+name)
+					} else {
+						params = append(params, "untyped "+a)
+					}
+				}
+				m.Types = []MethodType{{Text: "(" + strings.Join(params, ", ") + ") -> " + returns, Return: returns}}
+			}
+			i.MethodDecls = append(i.MethodDecls, m)
+		}
+		switch node.Name {
+		case "has_many", "has_and_belongs_to_many":
+			class := options["class_name"]
+			if class == "" {
+				class = camelize(singularize(name))
+			}
+			ids := singularize(name) + "_ids"
+			add(name, false, nil, "ActiveRecord::Associations::CollectionProxy["+class+"]")
+			add(name+"=", false, []string{name}, "")
+			add(ids, false, nil, "Array[Integer]")
+			add(ids+"=", false, []string{"ids"}, "")
+		case "has_one", "belongs_to":
+			class := options["class_name"]
+			if class == "" {
+				class = camelize(name)
+			}
+			add(name, false, nil, class)
+			add(name+"=", false, []string{name}, "")
+			add("build_"+name, false, []string{"attributes = {}"}, class)
+			add("create_"+name, false, []string{"attributes = {}"}, class)
+			add("create_"+name+"!", false, []string{"attributes = {}"}, class)
+			add("reload_"+name, false, nil, class)
+		case "scope":
+			var params []string
+			if len(args) > 1 {
+				params = lambdaParams(args[1])
+			}
+			add(name, true, params, "ActiveRecord::Relation")
+			// Only the name is a symbol argument; the body may contain more.
+			return nil
+		case "delegate":
+			target := options["to"]
+			if target == "" {
+				continue
+			}
+			method := name
+			switch prefix := options["prefix"]; prefix {
+			case "", "false":
+			case "true":
+				method = strings.TrimPrefix(target, "@") + "_" + name
+			default:
+				method = prefix + "_" + name
+			}
+			add(method, false, nil, "")
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// dslOptions returns the symbol, string, constant and boolean values of
+// the keyword arguments of a DSL call.
+func dslOptions(args []parser.Node) map[string]string {
+	options := make(map[string]string)
+	for _, arg := range args {
+		hash, ok := arg.(*parser.KeywordHashNode)
+		if !ok {
+			continue
+		}
+		for _, element := range hash.Elements {
+			assoc, ok := element.(*parser.AssocNode)
+			if !ok {
+				continue
+			}
+			key, ok := assoc.Key.(*parser.SymbolNode)
+			if !ok {
+				continue
+			}
+			switch v := assoc.Value.(type) {
+			case *parser.SymbolNode:
+				options[key.Unescaped] = v.Unescaped
+			case *parser.StringNode:
+				options[key.Unescaped] = v.Unescaped
+			case *parser.TrueNode:
+				options[key.Unescaped] = "true"
+			case *parser.FalseNode:
+				options[key.Unescaped] = "false"
+			default:
+				if name := constantPath(v); name != "" {
+					options[key.Unescaped] = name
+				}
+			}
+		}
+	}
+	return options
+}
+
+// dslSignature is the first line of the call, which is what hover shows
+// for the methods it defines.
+func dslSignature(node *parser.CallNode, file *sourceFile) string {
+	src := string(file.src[node.Loc.StartOffset:node.Loc.EndOffset()])
+	if line, _, ok := strings.Cut(src, "\n"); ok {
+		return strings.TrimSpace(line)
+	}
+	return src
+}
+
+func lambdaParams(node parser.Node) []string {
+	lambda, ok := node.(*parser.LambdaNode)
+	if !ok {
+		return nil
+	}
+	return blockParams(lambda.Parameters)
+}
+
+// singularize handles the regular English plurals association names use.
+func singularize(s string) string {
+	switch {
+	case strings.HasSuffix(s, "ies"):
+		return strings.TrimSuffix(s, "ies") + "y"
+	case strings.HasSuffix(s, "sses"), strings.HasSuffix(s, "ches"),
+		strings.HasSuffix(s, "shes"), strings.HasSuffix(s, "xes"):
+		return strings.TrimSuffix(s, "es")
+	case strings.HasSuffix(s, "ss"):
+		return s
+	case strings.HasSuffix(s, "s"):
+		return strings.TrimSuffix(s, "s")
+	}
+	return s
+}
@@ -0,0 +1,263 @@
+package index
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// RakeTask is a task or rule declared in a Rakefile or .rake file. Name is
+// qualified by the enclosing namespaces, e.g. db:seed:demo.
+type RakeTask struct {
+	Name        string
+	Description string
+	// Prerequisites are the task's dependencies as written, relative to
+	// its namespace.
+	Prerequisites []string
+	Rule          bool
+	r             *Range
+}
+
+// Range implements Node.
+func (t *RakeTask) Range() *Range {
+	return t.r
+}
+
+// Type implements Node.
+func (t *RakeTask) Type() NodeType {
+	return NodeTask
+}
+
+// IsRakeFile reports whether path is a Rakefile or a .rake file.
+func IsRakeFile(path string) bool {
+	switch filepath.Base(path) {
+	case "Rakefile", "rakefile", "Rakefile.rb", "rakefile.rb":
+		return true
+	}
+	return filepath.Ext(path) == ".rake"
+}
+
+// rakeTask reads the name, the node spanning it and the prerequisites of
+// a task, multitask, file or rule call. The forms are `task :name`,
+// `task name: deps` and `task :name, [:args] => deps`.
+func rakeTask(node *parser.CallNode) (name string, nameNode parser.Node, deps []parser.Node, ok bool) {
+	switch node.Name {
+	case "task", "multitask", "file", "directory", "rule":
+	default:
+		return "", nil, nil, false
+	}
+	if node.Receiver != nil || node.Arguments == nil {
+		return "", nil, nil, false
+	}
+	args := node.Arguments.Arguments
+	if name = literalName(args[0]); name != "" {
+		nameNode = args[0]
+		if len(args) > 1 {
+			if hash, ok := args[1].(*parser.KeywordHashNode); ok {
+				for _, element := range hash.Elements {
+					if assoc, ok := element.(*parser.AssocNode); ok {
+						deps = append(deps, taskNames(assoc.Value)...)
+					}
+				}
+			}
+		}
+		return name, nameNode, deps, true
+	}
+	hash, isHash := args[0].(*parser.KeywordHashNode)
+	if !isHash || len(hash.Elements) == 0 {
+		return "", nil, nil, false
+	}
+	assoc, isAssoc := hash.Elements[0].(*parser.AssocNode)
+	if !isAssoc {
+		return "", nil, nil, false
+	}
+	switch key := assoc.Key.(type) {
+	case *parser.RegularExpressionNode:
+		name = "/" + key.Unescaped + "/"
+	default:
+		name = literalName(key)
+	}
+	if name == "" {
+		return "", nil, nil, false
+	}
+	return name, assoc.Key, taskNames(assoc.Value), true
+}
+
+// taskNames returns the literal task names in a prerequisite, which is a
+// name or an array of them.
+func taskNames(node parser.Node) []parser.Node {
+	if array, ok := node.(*parser.ArrayNode); ok {
+		var res []parser.Node
+		for _, element := range array.Elements {
+			if literalName(element) != "" {
+				res = append(res, element)
+			}
+		}
+		return res
+	}
+	if literalName(node) != "" {
+		return []parser.Node{node}
+	}
+	return nil
+}
+
+// nameLocation is the location of the text of a string or symbol, without
+// its quotes or colons.
+func nameLocation(node parser.Node) *parser.Location {
+	switch n := node.(type) {
+	case *parser.SymbolNode:
+		if n.Valueloc != nil {
+			return n.Valueloc
+		}
+	case *parser.StringNode:
+		if n.Contentloc != nil {
+			return n.Contentloc
+		}
+	}
+	return node.Location()
+}
+
+func rakeNamespace(node *parser.CallNode) (string, *parser.BlockNode, bool) {
+	if node.Name != "namespace" || node.Receiver != nil || node.Arguments == nil {
+		return "", nil, false
+	}
+	block, ok := node.Block.(*parser.BlockNode)
+	name := literalName(node.Arguments.Arguments[0])
+	return name, block, ok && name != ""
+}
+
+func rakeDesc(node *parser.CallNode) (string, bool) {
+	if node.Name != "desc" || node.Receiver != nil || node.Arguments == nil {
+		return "", false
+	}
+	desc := literalName(node.Arguments.Arguments[0])
+	return desc, desc != ""
+}
+
+// indexRake indexes the tasks declared under node, a statement list in
+// the given namespace.
+func (i *Index) indexRake(node parser.Node, file *sourceFile, namespace string) {
+	if node == nil {
+		return
+	}
+	var desc string
+	for _, child := range node.Children() {
+		call, ok := child.(*parser.CallNode)
+		if !ok {
+			if child != nil {
+				i.indexRake(child, file, namespace)
+			}
+			continue
+		}
+		if d, ok := rakeDesc(call); ok {
+			desc = d
+			continue
+		}
+		if name, block, ok := rakeNamespace(call); ok {
+			i.indexRake(block.Body, file, qualifyTask(namespace, name))
+			continue
+		}
+		name, nameNode, deps, ok := rakeTask(call)
+		if !ok {
+			continue
+		}
+		loc := nameLocation(nameNode)
+		start, err := file.location(int(loc.StartOffset))
+		if err != nil {
+			continue
+		}
+		end, err := file.location(int(loc.EndOffset()))
+		if err != nil {
+			continue
+		}
+		task := RakeTask{Name: qualifyTask(namespace, name), Description: desc, Rule: call.Name == "rule", r: &Range{Start: start, End: end}}
+		for _, dep := range deps {
+			task.Prerequisites = append(task.Prerequisites, literalName(dep))
+		}
+		if task.Rule {
+			task.Name = name
+		}
+		i.Tasks = append(i.Tasks, task)
+		desc = ""
+	}
+}
+
+func qualifyTask(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + ":" + name
+}
+
+// LookupTask resolves a task name the way Rake does from within
+// namespace: in the namespace itself first, then in each enclosing one.
+// A leading "^" climbs a namespace and a leading "rake:" names the top
+// level.
+func (i *Index) LookupTask(name, namespace string) ([]*Range, bool) {
+	if strings.HasPrefix(name, "rake:") {
+		name, namespace = strings.TrimPrefix(name, "rake:"), ""
+	}
+	for strings.HasPrefix(name, "^") {
+		name = name[1:]
+		if k := strings.LastIndexByte(namespace, ':'); k >= 0 {
+			namespace = namespace[:k]
+		} else {
+			namespace = ""
+		}
+	}
+	for {
+		if tasks := i.table().tasks[qualifyTask(namespace, name)]; len(tasks) > 0 {
+			var ranges []*Range
+			for _, t := range tasks {
+				ranges = append(ranges, t.r)
+			}
+			return ranges, true
+		}
+		if namespace == "" {
+			return nil, false
+		}
+		if k := strings.LastIndexByte(namespace, ':'); k >= 0 {
+			namespace = namespace[:k]
+		} else {
+			namespace = ""
+		}
+	}
+}
+
+// rakeSymbol returns the outline entry of a namespace, task or rule call.
+func rakeSymbol(node *parser.CallNode, src []byte, dsl dialects) *Symbol {
+	if name, block, ok := rakeNamespace(node); ok {
+		s := newSymbol(name, SymbolNamespace, node.Loc, nameLocation(node.Arguments.Arguments[0]))
+		s.Detail = "namespace"
+		if block.Body != nil {
+			s.Children = outline(block.Body, src, dsl)
+		}
+		return s
+	}
+	name, nameNode, _, ok := rakeTask(node)
+	if !ok {
+		return nil
+	}
+	s := newSymbol(name, SymbolTask, node.Loc, nameLocation(nameNode))
+	s.Detail = node.Name
+	return s
+}
+
+// RakeNamespaceAt returns the Rake namespace around offset.
+func RakeNamespaceAt(symbols []*Symbol, offset int) string {
+	var namespace string
+	for symbols != nil {
+		var inner []*Symbol
+		for _, s := range symbols {
+			if s.Start <= offset && offset <= s.End {
+				if s.Kind == SymbolNamespace {
+					namespace = qualifyTask(namespace, s.Name)
+				}
+				inner = s.Children
+			}
+		}
+		symbols = inner
+	}
+	return namespace
+}
@@ -0,0 +1,502 @@
+package index
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// signatureIndex returns the index collecting declarations from signature
+// files, which are merged into i once the directory walk has finished.
+func (i *Index) signatureIndex() *Index {
+	if i.signatures == nil {
+		i.signatures = &Index{Root: i.Root, Indexed: true}
+	}
+	return i.signatures
+}
+
+func (i *Index) indexRBSFile(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	i.signatureIndex().indexRBS(path, src)
+	return nil
+}
+
+type rbsScope struct {
+	name string
+	// skip is set for interfaces, whose methods do not belong to any
+	// class until they are included.
+	skip bool
+}
+
+var (
+	rbsConstant  = regexp.MustCompile(`^(::)?[A-Z]\w*(::[A-Z]\w*)*\s*:\s*(.+)$`)
+	rbsKeyword   = regexp.MustCompile(`^(\??)([a-z_]\w*[?!]?):\s*(.+)$`)
+	rbsParamName = regexp.MustCompile(`^(.+)\s+([a-z_]\w*)$`)
+)
+
+// indexRBS reads the class, module, constant, method and attribute
+// declarations of an RBS file. It is line oriented: a declaration spans
+// several lines only while brackets are unbalanced or the next line
+// continues an overload with `|`.
+func (i *Index) indexRBS(path string, src []byte) {
+	lines := strings.Split(string(src), "\n")
+	var stack []rbsScope
+	// mixin adds to the innermost class or module, tracked by its position
+	// in the decl slices.
+	type declRef struct {
+		class bool
+		k     int
+	}
+	var decls []declRef
+	var comment []string
+	namespace := func() rbsScope {
+		if len(stack) == 0 {
+			return rbsScope{}
+		}
+		return stack[len(stack)-1]
+	}
+	for n := 0; n < len(lines); n++ {
+		raw := strings.TrimRight(lines[n], "\r")
+		line := strings.TrimSpace(raw)
+		if strings.HasPrefix(line, "#") {
+			comment = append(comment, strings.TrimPrefix(line, "#"))
+			continue
+		}
+		if line == "" {
+			comment = nil
+			continue
+		}
+		var doc *Doc
+		if len(comment) > 0 {
+			doc = parseDoc(comment)
+			comment = nil
+		}
+		start := n
+		stmt := stripAnnotations(line)
+		for n+1 < len(lines) && (bracketDepth(stmt) > 0 || strings.HasPrefix(strings.TrimSpace(lines[n+1]), "|")) {
+			n++
+			stmt += " " + strings.TrimSpace(lines[n])
+		}
+		r := &Range{
+			Start: &Location{Line: start, Character: len(raw) - len(strings.TrimLeft(raw, " \t")), FileURI: path},
+			End:   &Location{Line: n, Character: utf16Len([]byte(strings.TrimRight(lines[n], "\r"))), FileURI: path},
+		}
+		keyword, rest, _ := strings.Cut(stmt, " ")
+		rest = strings.TrimSpace(rest)
+		sc := namespace()
+		switch keyword {
+		case "class", "module":
+			name, tail := rbsDeclName(rest)
+			full := qualify(sc.name, name)
+			if strings.HasPrefix(name, "::") {
+				full = strings.TrimPrefix(name, "::")
+			}
+			owner, short, _ := cutLast(full, "::")
+			if keyword == "class" {
+				superclass := ""
+				if after, ok := strings.CutPrefix(strings.TrimSpace(tail), "<"); ok {
+					superclass, _ = rbsDeclName(strings.TrimSpace(after))
+				}
+				i.ClassDecls = append(i.ClassDecls, ClassDecl{Name: short, Owner: owner, Superclass: superclass, Doc: doc, r: r})
+			} else {
+				i.ModuleDecls = append(i.ModuleDecls, ModuleDecl{Name: short, Owner: owner, Doc: doc, r: r})
+			}
+			// `class Foo = Bar` aliases have no body.
+			if !strings.HasPrefix(strings.TrimSpace(tail), "=") {
+				stack = append(stack, rbsScope{name: full})
+				if keyword == "class" {
+					decls = append(decls, declRef{class: true, k: len(i.ClassDecls) - 1})
+				} else {
+					decls = append(decls, declRef{k: len(i.ModuleDecls) - 1})
+				}
+			}
+		case "interface":
+			stack = append(stack, rbsScope{name: sc.name, skip: true})
+			decls = append(decls, declRef{k: -1})
+		case "end":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+				decls = decls[:len(decls)-1]
+			}
+		case "include", "prepend", "extend":
+			if len(decls) == 0 || decls[len(decls)-1].k < 0 {
+				continue
+			}
+			name, _ := rbsDeclName(rest)
+			ref := decls[len(decls)-1]
+			extend := keyword == "extend"
+			switch {
+			case ref.class && extend:
+				i.ClassDecls[ref.k].Extends = append(i.ClassDecls[ref.k].Extends, name)
+			case ref.class:
+				i.ClassDecls[ref.k].Includes = append(i.ClassDecls[ref.k].Includes, name)
+			case extend:
+				i.ModuleDecls[ref.k].Extends = append(i.ModuleDecls[ref.k].Extends, name)
+			default:
+				i.ModuleDecls[ref.k].Includes = append(i.ModuleDecls[ref.k].Includes, name)
+			}
+		case "def":
+			if sc.skip {
+				continue
+			}
+			name, types, ok := strings.Cut(rest, ":")
+			if !ok {
+				continue
+			}
+			name = strings.TrimSpace(name)
+			singleton := []bool{false}
+			if after, ok := strings.CutPrefix(name, "self?."); ok {
+				name, singleton = after, []bool{true, false}
+			} else if after, ok := strings.CutPrefix(name, "self."); ok {
+				name, singleton = after, []bool{true}
+			}
+			overloads := parseMethodTypes(types)
+			for _, s := range singleton {
+				i.MethodDecls = append(i.MethodDecls, MethodDecl{
+					Name:      strings.Trim(name, "`"),
+					Owner:     sc.name,
+					Singleton: s,
+					Doc:       doc,
+					Types:     overloads,
+					Args:      typedParamNames(overloads),
+					r:         r,
+				})
+			}
+		case "attr_reader", "attr_writer", "attr_accessor":
+			if sc.skip {
+				continue
+			}
+			name, typ, ok := strings.Cut(rest, ":")
+			if !ok {
+				continue
+			}
+			name, _, _ = strings.Cut(strings.TrimSpace(name), " ")
+			name, singleton := strings.CutPrefix(name, "self.")
+			typ = strings.TrimSpace(typ)
+			if keyword != "attr_writer" {
+				i.MethodDecls = append(i.MethodDecls, MethodDecl{
+					Name:      name,
+					Owner:     sc.name,
+					Singleton: singleton,
+					Doc:       doc,
+					Types:     []MethodType{{Text: "() -> " + typ, Return: typ}},
+					r:         r,
+				})
+			}
+			if keyword != "attr_reader" {
+				i.MethodDecls = append(i.MethodDecls, MethodDecl{
+					Name:      name + "=",
+					Owner:     sc.name,
+					Singleton: singleton,
+					Doc:       doc,
+					Types: []MethodType{{
+						Text:   "(" + typ + " " + name + ") -> " + typ,
+						Params: []TypedParam{{Name: name, Type: typ}},
+						Return: typ,
+					}},
+					Args: []string{name},
+					r:    r,
+				})
+			}
+		default:
+			if m := rbsConstant.FindStringSubmatch(stmt); m != nil && !sc.skip {
+				name, _, _ := strings.Cut(stmt, ":")
+				full := qualify(sc.name, strings.TrimSpace(name))
+				owner, short, _ := cutLast(strings.TrimPrefix(full, "::"), "::")
+				i.ConstantDecls = append(i.ConstantDecls, ConstantDecl{Name: short, Owner: owner, Value: m[3], Doc: doc, r: r})
+			}
+		}
+	}
+}
+
+// rbsDeclName splits a class or module header into the constant name and
+// whatever follows it (type parameters are dropped).
+func rbsDeclName(s string) (string, string) {
+	end := strings.IndexAny(s, " [<:=")
+	for end >= 0 && strings.HasPrefix(s[end:], "::") {
+		next := strings.IndexAny(s[end+2:], " [<:=")
+		if next < 0 {
+			end = -1
+			break
+		}
+		end += 2 + next
+	}
+	if end < 0 {
+		return s, ""
+	}
+	name, tail := s[:end], s[end:]
+	if strings.HasPrefix(tail, "[") {
+		if close := matchingBracket(tail, 0); close > 0 {
+			tail = tail[close+1:]
+		}
+	}
+	return name, tail
+}
+
+func stripAnnotations(line string) string {
+	for strings.HasPrefix(line, "%a") && len(line) > 2 {
+		close := matchingBracket(line, 2)
+		if close < 0 {
+			return line
+		}
+		line = strings.TrimSpace(line[close+1:])
+	}
+	return line
+}
+
+func bracketDepth(s string) int {
+	depth := 0
+	for k := 0; k < len(s); k++ {
+		switch s[k] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// matchingBracket returns the index of the bracket closing the one at
+// s[open], or -1.
+func matchingBracket(s string, open int) int {
+	depth := 0
+	for k := open; k < len(s); k++ {
+		switch s[k] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return k
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits s on sep outside of any brackets. When next is
+// non-nil, a separator only counts if next accepts the text following it.
+func splitTopLevel(s string, sep byte, next func(string) bool) []string {
+	var parts []string
+	depth := 0
+	last := 0
+	for k := 0; k < len(s); k++ {
+		switch s[k] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case sep:
+			if depth == 0 && (next == nil || next(strings.TrimSpace(s[k+1:]))) {
+				parts = append(parts, strings.TrimSpace(s[last:k]))
+				last = k + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(s[last:]))
+}
+
+// parseMethodTypes parses the overloads of an RBS method declaration. A
+// top level `|` separates overloads only when a new method type follows it;
+// otherwise it belongs to a union type.
+func parseMethodTypes(s string) []MethodType {
+	var types []MethodType
+	overloads := splitTopLevel(strings.TrimSpace(s), '|', func(rest string) bool {
+		return rest == "..." || strings.HasPrefix(rest, "(") || strings.HasPrefix(rest, "[") ||
+			strings.HasPrefix(rest, "{") || strings.HasPrefix(rest, "?{") || strings.HasPrefix(rest, "->")
+	})
+	for _, o := range overloads {
+		if o == "..." || o == "" {
+			continue
+		}
+		types = append(types, parseMethodType(o))
+	}
+	return types
+}
+
+func parseMethodType(s string) MethodType {
+	mt := MethodType{Text: s}
+	rest := strings.TrimSpace(s)
+	if strings.HasPrefix(rest, "[") {
+		if close := matchingBracket(rest, 0); close > 0 {
+			rest = strings.TrimSpace(rest[close+1:])
+		}
+	}
+	if strings.HasPrefix(rest, "(") {
+		close := matchingBracket(rest, 0)
+		if close < 0 {
+			return mt
+		}
+		mt.Params = parseTypedParams(rest[1:close])
+		rest = strings.TrimSpace(rest[close+1:])
+	}
+	if strings.HasPrefix(rest, "?{") || strings.HasPrefix(rest, "{") {
+		open := strings.Index(rest, "{")
+		close := matchingBracket(rest, open)
+		if close < 0 {
+			return mt
+		}
+		mt.Params = append(mt.Params, TypedParam{Type: rest[:close+1], Kind: ParamBlock})
+		rest = strings.TrimSpace(rest[close+1:])
+	}
+	if after, ok := strings.CutPrefix(rest, "->"); ok {
+		mt.Return = strings.TrimSpace(after)
+	}
+	return mt
+}
+
+func parseTypedParams(s string) []TypedParam {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	var params []TypedParam
+	for _, p := range splitTopLevel(s, ',', nil) {
+		var param TypedParam
+		switch {
+		case strings.HasPrefix(p, "**"):
+			param.Kind, p = ParamKeywordRest, p[2:]
+		case strings.HasPrefix(p, "*"):
+			param.Kind, p = ParamRest, p[1:]
+		default:
+			if m := rbsKeyword.FindStringSubmatch(p); m != nil {
+				param.Kind, param.Name, param.Type = ParamKeyword, m[2], m[3]
+				if m[1] == "?" {
+					param.Kind = ParamOptionalKeyword
+				}
+				params = append(params, param)
+				continue
+			}
+			if strings.HasPrefix(p, "?") {
+				param.Kind, p = ParamOptional, p[1:]
+			}
+		}
+		param.Type = strings.TrimSpace(p)
+		if m := rbsParamName.FindStringSubmatch(param.Type); m != nil && bracketDepth(m[1]) == 0 && !strings.HasSuffix(m[1], "|") && !strings.HasSuffix(m[1], "->") {
+			param.Type, param.Name = strings.TrimSpace(m[1]), m[2]
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+func typedParamNames(types []MethodType) []string {
+	if len(types) == 0 {
+		return nil
+	}
+	var names []string
+	for _, p := range types[0].Params {
+		if p.Name != "" {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// mergeSignatures folds the declarations read from signature files into
+// the index. Types and documentation are attached to the matching Ruby
+// declaration; declarations only present in signatures are added as is.
+func (i *Index) mergeSignatures() {
+	sigs := i.signatures
+	if sigs == nil {
+		return
+	}
+	i.signatures = nil
+
+	type methodKey struct {
+		name      string
+		singleton bool
+	}
+	methods := make(map[methodKey]*MethodDecl)
+	for k := range i.MethodDecls {
+		m := &i.MethodDecls[k]
+		methods[methodKey{m.FullName(), m.Singleton}] = m
+	}
+	var added []MethodDecl
+	for _, sig := range sigs.MethodDecls {
+		m, ok := methods[methodKey{sig.FullName(), sig.Singleton}]
+		if !ok {
+			added = append(added, sig)
+			continue
+		}
+		m.Types = append(m.Types, sig.Types...)
+		if m.Doc == nil {
+			m.Doc = sig.Doc
+		}
+	}
+	i.MethodDecls = append(i.MethodDecls, added...)
+
+	modules := make(map[string]*ModuleDecl)
+	for k := range i.ModuleDecls {
+		modules[i.ModuleDecls[k].FullName()] = &i.ModuleDecls[k]
+	}
+	var addedModules []ModuleDecl
+	for _, sig := range sigs.ModuleDecls {
+		if m, ok := modules[sig.FullName()]; ok {
+			if m.Doc == nil {
+				m.Doc = sig.Doc
+			}
+			m.Includes = appendMissing(m.Includes, sig.Includes...)
+			m.Extends = appendMissing(m.Extends, sig.Extends...)
+			continue
+		}
+		addedModules = append(addedModules, sig)
+	}
+	i.ModuleDecls = append(i.ModuleDecls, addedModules...)
+
+	classes := make(map[string]*ClassDecl)
+	for k := range i.ClassDecls {
+		classes[i.ClassDecls[k].FullName()] = &i.ClassDecls[k]
+	}
+	var addedClasses []ClassDecl
+	for _, sig := range sigs.ClassDecls {
+		if c, ok := classes[sig.FullName()]; ok {
+			if c.Doc == nil {
+				c.Doc = sig.Doc
+			}
+			if c.Superclass == "" {
+				c.Superclass = sig.Superclass
+			}
+			c.Includes = appendMissing(c.Includes, sig.Includes...)
+			c.Extends = appendMissing(c.Extends, sig.Extends...)
+			continue
+		}
+		addedClasses = append(addedClasses, sig)
+	}
+	i.ClassDecls = append(i.ClassDecls, addedClasses...)
+
+	constants := make(map[string]*ConstantDecl)
+	for k := range i.ConstantDecls {
+		constants[i.ConstantDecls[k].FullName()] = &i.ConstantDecls[k]
+	}
+	var addedConstants []ConstantDecl
+	for _, sig := range sigs.ConstantDecls {
+		if c, ok := constants[sig.FullName()]; ok {
+			if c.Doc == nil {
+				c.Doc = sig.Doc
+			}
+			continue
+		}
+		addedConstants = append(addedConstants, sig)
+	}
+	i.ConstantDecls = append(i.ConstantDecls, addedConstants...)
+}
+
+func appendMissing(list []string, names ...string) []string {
+	for _, name := range names {
+		found := false
+		for _, existing := range list {
+			if existing == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, name)
+		}
+	}
+	return list
+}
@@ -0,0 +1,281 @@
+package index
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+type RefKind int
+
+const (
+	RefConstant RefKind = iota
+	RefCall
+	// RefSuper is a `super` call, which refers to the method it appears
+	// in as defined by an ancestor.
+	RefSuper
+	// RefSymbol is a method named by a symbol argument, such as
+	// `before_action :authenticate`.
+	RefSymbol
+	// RefSharedGroup includes RSpec shared examples or a shared context,
+	// as `it_behaves_like "a payable"` does.
+	RefSharedGroup
+)
+
+// ReceiverKind is the kind of expression a method is called on.
+type ReceiverKind int
+
+const (
+	ReceiverNone ReceiverKind = iota
+	ReceiverSelf
+	ReceiverConstant
+	ReceiverVariable
+	ReceiverExpression
+)
+
+type Reference struct {
+	Name     string
+	Kind     RefKind
+	Receiver ReceiverKind
+	// Path is the constant as written, such as Foo::Bar, for constant
+	// references and for calls on a constant.
+	Path string
+	// Scope is the class or module the reference appears in and Method
+	// the method, if any. Singleton is set in class methods and
+	// singleton class bodies.
+	Scope     string
+	Method    string
+	Singleton bool
+	// Nesting is the lexical nesting of the reference, innermost first.
+	Nesting []string
+	r       *Range
+}
+
+func (r *Reference) Range() *Range {
+	return r.r
+}
+
+// declaringCalls name methods through symbols rather than refer to them.
+var declaringCalls = map[string]bool{
+	"attr_reader":   true,
+	"attr_writer":   true,
+	"attr_accessor": true,
+}
+
+type refScope struct {
+	namespace string
+	nesting   []string
+	method    string
+	singleton bool
+}
+
+// nest returns the scope of the body of a class or module declared
+// through path.
+func (sc refScope) nest(path parser.Node) refScope {
+	full := declName(sc.namespace, path)
+	return refScope{namespace: full, nesting: append([]string{full}, sc.nesting...)}
+}
+
+// indexReferences records the constant reads, method calls, super calls
+// and symbol arguments under node, along with the instance and class
+// variables it assigns and the files it requires.
+func (i *Index) indexReferences(node parser.Node, file *sourceFile, sc refScope) {
+	if node == nil {
+		return
+	}
+	i.indexVariable(node, file, sc)
+	switch n := node.(type) {
+	case *parser.ClassNode:
+		// The name being declared is not a reference, its namespace is.
+		if path, ok := n.Constantpath.(*parser.ConstantPathNode); ok {
+			i.indexReferences(path.Parent, file, sc)
+		}
+		i.indexReferences(n.Superclass, file, sc)
+		i.indexReferences(n.Body, file, sc.nest(n.Constantpath))
+		return
+	case *parser.ModuleNode:
+		if path, ok := n.Constantpath.(*parser.ConstantPathNode); ok {
+			i.indexReferences(path.Parent, file, sc)
+		}
+		i.indexReferences(n.Body, file, sc.nest(n.Constantpath))
+		return
+	case *parser.SingletonClassNode:
+		i.indexReferences(n.Expression, file, sc)
+		_, self := n.Expression.(*parser.SelfNode)
+		i.indexReferences(n.Body, file, refScope{namespace: sc.namespace, nesting: sc.nesting, singleton: self})
+		return
+	case *parser.DefNode:
+		_, self := n.Receiver.(*parser.SelfNode)
+		inner := refScope{namespace: sc.namespace, nesting: sc.nesting, method: n.Name, singleton: sc.singleton || self}
+		if n.Parameters != nil {
+			i.indexReferences(n.Parameters, file, inner)
+		}
+		i.indexReferences(n.Body, file, inner)
+		return
+	case *parser.ConstantReadNode:
+		i.addReference(Reference{Name: n.Name, Kind: RefConstant, Path: n.Name}, n.Loc, file, sc)
+	case *parser.ConstantPathNode:
+		// The path is one reference, to its last segment.
+		if child, ok := n.Child.(*parser.ConstantReadNode); ok {
+			i.addReference(Reference{Name: child.Name, Kind: RefConstant, Path: constantPath(n)}, child.Loc, file, sc)
+		}
+		i.indexReferences(n.Parent, file, sc)
+		return
+	case *parser.CallNode:
+		i.indexRequire(n, file)
+		i.indexSpec(n, file, sc)
+		if n.Messageloc != nil {
+			ref := Reference{Name: n.Name, Kind: RefCall, Receiver: receiverKind(n.Receiver)}
+			if ref.Receiver == ReceiverConstant {
+				ref.Path = constantPath(n.Receiver)
+			}
+			i.addReference(ref, n.Messageloc, file, sc)
+		}
+		if n.Receiver == nil && n.Arguments != nil && !declaringCalls[n.Name] {
+			for _, arg := range n.Arguments.Arguments {
+				i.indexSymbolArgument(arg, file, sc)
+			}
+		}
+	case *parser.SuperNode:
+		if sc.method != "" {
+			i.addReference(Reference{Name: sc.method, Kind: RefSuper}, n.Keywordloc, file, sc)
+		}
+	case *parser.ForwardingSuperNode:
+		if sc.method != "" {
+			i.addReference(Reference{Name: sc.method, Kind: RefSuper}, n.Loc, file, sc)
+		}
+	}
+	for _, child := range node.Children() {
+		i.indexReferences(child, file, sc)
+	}
+}
+
+// indexSymbolArgument records `:name` arguments and option values such
+// as `if: :admin?` of DSL calls.
+func (i *Index) indexSymbolArgument(arg parser.Node, file *sourceFile, sc refScope) {
+	switch a := arg.(type) {
+	case *parser.SymbolNode:
+		if a.Valueloc != nil {
+			i.addReference(Reference{Name: a.Unescaped, Kind: RefSymbol}, a.Valueloc, file, sc)
+		}
+	case *parser.KeywordHashNode:
+		for _, element := range a.Elements {
+			if assoc, ok := element.(*parser.AssocNode); ok {
+				i.indexSymbolArgument(assoc.Value, file, sc)
+			}
+		}
+	case *parser.ArrayNode:
+		for _, element := range a.Elements {
+			i.indexSymbolArgument(element, file, sc)
+		}
+	}
+}
+
+func receiverKind(node parser.Node) ReceiverKind {
+	switch node.(type) {
+	case nil:
+		return ReceiverNone
+	case *parser.SelfNode:
+		return ReceiverSelf
+	case *parser.ConstantReadNode, *parser.ConstantPathNode:
+		return ReceiverConstant
+	case *parser.LocalVariableReadNode, *parser.InstanceVariableReadNode,
+		*parser.ClassVariableReadNode, *parser.GlobalVariableReadNode:
+		return ReceiverVariable
+	}
+	return ReceiverExpression
+}
+
+func (i *Index) addReference(ref Reference, loc *parser.Location, file *sourceFile, sc refScope) {
+	start, err := file.location(int(loc.StartOffset))
+	if err != nil {
+		return
+	}
+	end, err := file.location(int(loc.EndOffset()))
+	if err != nil {
+		return
+	}
+	ref.Scope, ref.Method, ref.Singleton, ref.Nesting = sc.namespace, sc.method, sc.singleton, sc.nesting
+	ref.r = &Range{Start: start, End: end}
+	i.References = append(i.References, ref)
+}
+
+// ReferencesTo returns the workspace references of the given kinds to the
+// unqualified name.
+func (i *Index) ReferencesTo(name string, kinds ...RefKind) []*Reference {
+	var res []*Reference
+	for _, ref := range i.table().references[name] {
+		if slices.Contains(kinds, ref.Kind) {
+			res = append(res, ref)
+		}
+	}
+	return res
+}
+
+// ConstantReferencesTo returns the workspace references to the constant
+// written as path in the given lexical nesting: those resolving to the same
+// constant or, when it cannot be resolved, written the same way.
+func (i *Index) ConstantReferencesTo(path string, nesting []string) []*Reference {
+	full, _, resolved := i.ResolveConstant(path, nesting)
+	_, short, _ := cutLast(strings.TrimPrefix(path, "::"), "::")
+	var res []*Reference
+	for _, ref := range i.table().references[short] {
+		if ref.Kind != RefConstant {
+			continue
+		}
+		name, _, ok := i.ResolveConstant(ref.Path, ref.Nesting)
+		if ok && resolved && name == full || !ok && !resolved && ref.Path == path {
+			res = append(res, ref)
+		}
+	}
+	return res
+}
+
+// MethodReferencesTo returns the workspace calls, super calls and symbol
+// arguments that may reach one of methods, which share a name. References
+// on self, on a constant or naming a method by symbol are resolved from
+// where they appear. The class of other receivers is not known, so calls
+// on them are only kept when methods holds every method by that name.
+func (i *Index) MethodReferencesTo(name string, methods []*MethodDecl) []*Reference {
+	all := true
+	for _, m := range i.Methods(name) {
+		all = all && slices.Contains(methods, m)
+	}
+	var res []*Reference
+	for _, ref := range i.table().references[name] {
+		var found []*MethodDecl
+		switch {
+		case ref.Kind == RefSymbol:
+			found = i.MethodsFor(Type{Name: selfName(ref.Scope)}, name)
+		case ref.Kind == RefSuper:
+			found = i.MethodsFor(Type{Name: selfName(ref.Scope), Singleton: ref.Singleton}, name)
+			if len(found) > 0 {
+				found = found[1:]
+			}
+		case ref.Kind != RefCall:
+			continue
+		case ref.Receiver == ReceiverNone || ref.Receiver == ReceiverSelf:
+			// Outside methods, self is the class or module itself.
+			singleton := ref.Singleton || ref.Method == "" && ref.Scope != ""
+			found = i.MethodsFor(Type{Name: selfName(ref.Scope), Singleton: singleton}, name)
+		case ref.Receiver == ReceiverConstant:
+			if full, _, ok := i.ResolveConstant(ref.Path, ref.Nesting); ok {
+				found = i.MethodsFor(Type{Name: full, Singleton: true}, name)
+			}
+		}
+		if len(found) > 0 && slices.Contains(methods, found[0]) || len(found) == 0 && all {
+			res = append(res, ref)
+		}
+	}
+	return res
+}
+
+// selfName returns the class self is an instance of in scope, Object at
+// the top level.
+func selfName(scope string) string {
+	if scope == "" {
+		return "Object"
+	}
+	return scope
+}
@@ -0,0 +1,179 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// DefaultLoadPath holds the workspace directories test and library code
+// usually puts on $LOAD_PATH.
+var DefaultLoadPath = []string{"lib", "test", "spec"}
+
+// Require is a call loading another file, such as `require "json"` or
+// `autoload :Pricing, "shop/pricing"`.
+type Require struct {
+	// Method is require, require_relative, load or autoload.
+	Method string
+	// Path is the path as written.
+	Path string
+	// From is the requiring file.
+	From string
+	// r spans the contents of the path string.
+	r *Range
+}
+
+func (r *Require) Range() *Range {
+	return r.r
+}
+
+// indexRequire records node if it is a call loading a file by a literal
+// path.
+func (i *Index) indexRequire(node *parser.CallNode, file *sourceFile) {
+	if node.Receiver != nil || node.Arguments == nil {
+		return
+	}
+	args := node.Arguments.Arguments
+	switch node.Name {
+	case "require", "require_relative", "load":
+	case "autoload":
+		if len(args) < 2 {
+			return
+		}
+		args = args[1:]
+	default:
+		return
+	}
+	str, ok := args[0].(*parser.StringNode)
+	if !ok || str.Contentloc == nil {
+		return
+	}
+	start, err := file.location(int(str.Contentloc.StartOffset))
+	if err != nil {
+		return
+	}
+	end, err := file.location(int(str.Contentloc.EndOffset()))
+	if err != nil {
+		return
+	}
+	i.Requires = append(i.Requires, Require{
+		Method: node.Name,
+		Path:   str.Unescaped,
+		From:   file.path,
+		r:      &Range{Start: start, End: end},
+	})
+}
+
+// FileRequires returns the requires in src, the contents of the file at
+// path.
+func FileRequires(path string, src []byte) ([]Require, error) {
+	result, err := parseDocument(src)
+	if err != nil {
+		return nil, err
+	}
+	lines := NewLineIndex(src)
+	file := &sourceFile{path: path, src: src, lines: lines}
+	i := &Index{}
+	var walk func(node parser.Node)
+	walk = func(node parser.Node) {
+		if call, ok := node.(*parser.CallNode); ok {
+			i.indexRequire(call, file)
+		}
+		for _, child := range node.Children() {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(result.Value)
+	return i.Requires, nil
+}
+
+// ResolveRequire returns the file r loads. require_relative is resolved
+// against the requiring file, paths starting with "./" or "../" against
+// the workspace root and other paths through the load path, workspace
+// first.
+func (i *Index) ResolveRequire(r *Require) (string, bool) {
+	t := i.table()
+	if t == noSymbols {
+		return i.resolveRequire(r)
+	}
+	key := requireKey(r)
+	if v, ok := t.resolved.Load(key); ok {
+		path := v.(string)
+		return path, path != ""
+	}
+	path, _ := i.resolveRequire(r)
+	t.resolved.Store(key, path)
+	return path, path != ""
+}
+
+// requireKey identifies the requires that load the same file: those with
+// the same method and path, from the same directory for require_relative.
+func requireKey(r *Require) string {
+	if r.Method == "require_relative" {
+		return r.Method + " " + filepath.Join(filepath.Dir(r.From), r.Path)
+	}
+	return r.Method + " " + r.Path
+}
+
+func (i *Index) resolveRequire(r *Require) (string, bool) {
+	var dirs []string
+	switch {
+	case filepath.IsAbs(r.Path):
+		dirs = []string{""}
+	case r.Method == "require_relative":
+		dirs = []string{filepath.Dir(r.From)}
+	case strings.HasPrefix(r.Path, "./") || strings.HasPrefix(r.Path, "../"):
+		dirs = []string{i.Root}
+	default:
+		for _, l := range []*Index{i, i.Dependencies} {
+			if l == nil {
+				continue
+			}
+			for _, dir := range l.LoadPath {
+				if !filepath.IsAbs(dir) {
+					dir = filepath.Join(i.Root, dir)
+				}
+				dirs = append(dirs, dir)
+			}
+		}
+		if r.Method == "load" {
+			dirs = append([]string{i.Root}, dirs...)
+		}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, r.Path)
+		candidates := []string{path}
+		if filepath.Ext(path) != ".rb" {
+			candidates = []string{path + ".rb", path}
+		}
+		for _, c := range candidates {
+			if info, err := os.Stat(c); err == nil && !info.IsDir() {
+				return c, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Dependency is an edge of the require graph. To is empty when the
+// required file could not be found, as for most standard libraries.
+type Dependency struct {
+	From    string
+	To      string
+	Require *Require
+}
+
+// DependencyGraph resolves the requires of the workspace files.
+func (i *Index) DependencyGraph() []Dependency {
+	var res []Dependency
+	for k := range i.Requires {
+		r := &i.Requires[k]
+		to, _ := i.ResolveRequire(r)
+		res = append(res, Dependency{From: r.From, To: to, Require: r})
+	}
+	return res
+}
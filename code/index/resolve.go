@@ -0,0 +1,89 @@
+package index
+
+import (
+	"sort"
+	"strings"
+)
+
+// ResolveConstant resolves a constant reference as Ruby would from code
+// with the given lexical nesting, innermost first as Module.nesting
+// returns it. Each segment of a scoped path is looked up in the lexical
+// scopes, then the ancestors of the innermost one, then at the top level.
+// It returns the fully qualified name and its declarations, workspace and
+// canonical ones first.
+func (i *Index) ResolveConstant(path string, nesting []string) (string, []Node, bool) {
+	absolute := strings.HasPrefix(path, "::")
+	segments := strings.Split(strings.TrimPrefix(path, "::"), "::")
+	var full string
+	if absolute {
+		full = segments[0]
+		if len(i.constantsNamed(full)) == 0 {
+			return "", nil, false
+		}
+	} else {
+		var ok bool
+		if full, ok = i.resolveLexical(segments[0], nesting); !ok {
+			return "", nil, false
+		}
+	}
+	for _, name := range segments[1:] {
+		var ok bool
+		if full, ok = i.resolveIn(full, name); !ok {
+			return "", nil, false
+		}
+	}
+	nodes := i.constantsNamed(full)
+	sort.SliceStable(nodes, func(a, b int) bool {
+		return i.canonical(nodes[a]) && !i.canonical(nodes[b])
+	})
+	return full, nodes, true
+}
+
+func (i *Index) resolveLexical(name string, nesting []string) (string, bool) {
+	for _, n := range nesting {
+		if full := qualify(n, name); len(i.constantsNamed(full)) > 0 {
+			return full, true
+		}
+	}
+	if len(nesting) > 0 {
+		if full, ok := i.resolveIn(nesting[0], name); ok {
+			return full, true
+		}
+	}
+	return name, len(i.constantsNamed(name)) > 0
+}
+
+// resolveIn looks name up in the ancestors of owner. Constants of Object
+// are only found through it when owner is Object itself, as in Ruby.
+func (i *Index) resolveIn(owner, name string) (string, bool) {
+	for _, a := range i.Ancestors(owner) {
+		if a == "Object" || a == "BasicObject" || a == "Kernel" {
+			if owner != a {
+				continue
+			}
+			return name, len(i.constantsNamed(name)) > 0
+		}
+		if full := qualify(a, name); len(i.constantsNamed(full)) > 0 {
+			return full, true
+		}
+	}
+	return "", false
+}
+
+// constantsNamed returns the declarations of the fully qualified constant.
+func (i *Index) constantsNamed(full string) []Node {
+	_, short, _ := cutLast(full, "::")
+	return filter(i.Constants(short), func(n Node) bool {
+		return qualifiedName(n) == full
+	})
+}
+
+// ConstantsIn returns the modules, classes and constants declared directly
+// in the namespace with the given fully qualified name.
+func (i *Index) ConstantsIn(namespace string) []Node {
+	var res []Node
+	for _, l := range i.layers() {
+		res = append(res, l.table().members[namespace]...)
+	}
+	return res
+}
@@ -0,0 +1,175 @@
+package index
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+var specKinds = map[string]SymbolKind{
+	"describe":              SymbolExampleGroup,
+	"context":               SymbolExampleGroup,
+	"feature":               SymbolExampleGroup,
+	"example_group":         SymbolExampleGroup,
+	"xdescribe":             SymbolExampleGroup,
+	"xcontext":              SymbolExampleGroup,
+	"fdescribe":             SymbolExampleGroup,
+	"fcontext":              SymbolExampleGroup,
+	"it_behaves_like":       SymbolExampleGroup,
+	"it_should_behave_like": SymbolExampleGroup,
+	"include_examples":      SymbolExampleGroup,
+	"include_context":       SymbolExampleGroup,
+	"shared_examples":       SymbolSharedGroup,
+	"shared_examples_for":   SymbolSharedGroup,
+	"shared_context":        SymbolSharedGroup,
+	"it":                    SymbolExample,
+	"specify":               SymbolExample,
+	"example":               SymbolExample,
+	"scenario":              SymbolExample,
+	"its":                   SymbolExample,
+	"xit":                   SymbolExample,
+	"fit":                   SymbolExample,
+	"let":                   SymbolLet,
+	"let!":                  SymbolLet,
+	"subject":               SymbolLet,
+	"subject!":              SymbolLet,
+	"before":                SymbolHook,
+	"after":                 SymbolHook,
+	"around":                SymbolHook,
+}
+
+// includesShared names the calls that include shared examples or contexts.
+var includesShared = map[string]bool{
+	"it_behaves_like":       true,
+	"it_should_behave_like": true,
+	"include_examples":      true,
+	"include_context":       true,
+}
+
+// IsSpecFile reports whether path is an RSpec file: one ending in _spec.rb
+// or under a spec directory.
+func IsSpecFile(path string) bool {
+	path = filepath.ToSlash(path)
+	return strings.HasSuffix(path, "_spec.rb") || strings.HasPrefix(path, "spec/") || strings.Contains(path, "/spec/")
+}
+
+// isSpecCall reports whether node is an RSpec DSL call, made without a
+// receiver or on RSpec itself. Groups and examples take a block, except
+// for the calls including shared ones.
+func isSpecCall(node *parser.CallNode) bool {
+	kind, ok := specKinds[node.Name]
+	if !ok {
+		return false
+	}
+	switch kind {
+	case SymbolExampleGroup, SymbolSharedGroup, SymbolExample:
+		if _, ok := node.Block.(*parser.BlockNode); !ok && !includesShared[node.Name] {
+			return false
+		}
+	}
+	return node.Receiver == nil || constantPath(node.Receiver) == "RSpec"
+}
+
+func specSymbol(node *parser.CallNode, src []byte) *Symbol {
+	if !isSpecCall(node) {
+		return nil
+	}
+	kind := specKinds[node.Name]
+	var args []parser.Node
+	if node.Arguments != nil {
+		args = node.Arguments.Arguments
+	}
+	var nameLoc *parser.Location
+	if len(args) > 0 {
+		nameLoc = args[0].Location()
+	}
+	name := description(args, src)
+	switch {
+	case kind == SymbolLet && len(args) == 0:
+		name = "subject"
+	case kind == SymbolLet:
+		name = literalName(args[0])
+		if sym, ok := args[0].(*parser.SymbolNode); ok && sym.Valueloc != nil {
+			nameLoc = sym.Valueloc
+		}
+	case name == "":
+		name = node.Name
+	}
+	s := newSymbol(name, kind, node.Loc, nameLoc)
+	s.Detail = node.Name
+	if block, ok := node.Block.(*parser.BlockNode); ok && block.Body != nil && kind != SymbolLet {
+		s.Children = outline(block.Body, src, dialects{spec: true})
+	}
+	return s
+}
+
+// LetAt returns the let or subject named name that is visible at offset:
+// the one defined by the innermost example group around offset.
+func LetAt(symbols []*Symbol, name string, offset int) *Symbol {
+	var found *Symbol
+	for symbols != nil {
+		var inner []*Symbol
+		for _, s := range symbols {
+			if s.Kind == SymbolLet && s.Name == name {
+				found = s
+			}
+			if s.Start <= offset && offset <= s.End && s.Kind != SymbolLet {
+				inner = s.Children
+			}
+		}
+		symbols = inner
+	}
+	return found
+}
+
+// SharedGroup is a shared_examples or shared_context definition.
+type SharedGroup struct {
+	Name string
+	r    *Range
+}
+
+func (g *SharedGroup) Range() *Range {
+	return g.r
+}
+
+// indexSpec records the shared groups a spec defines and the places they
+// are included from.
+func (i *Index) indexSpec(node *parser.CallNode, file *sourceFile, sc refScope) {
+	if !IsSpecFile(file.path) || !isSpecCall(node) || node.Arguments == nil {
+		return
+	}
+	arg := node.Arguments.Arguments[0]
+	name := literalName(arg)
+	if name == "" {
+		return
+	}
+	loc := arg.Location()
+	if str, ok := arg.(*parser.StringNode); ok && str.Contentloc != nil {
+		loc = str.Contentloc
+	}
+	switch {
+	case specKinds[node.Name] == SymbolSharedGroup:
+		start, err := file.location(int(loc.StartOffset))
+		if err != nil {
+			return
+		}
+		end, err := file.location(int(loc.EndOffset()))
+		if err != nil {
+			return
+		}
+		i.SharedGroups = append(i.SharedGroups, SharedGroup{Name: name, r: &Range{Start: start, End: end}})
+	case includesShared[node.Name]:
+		i.addReference(Reference{Name: name, Kind: RefSharedGroup}, loc, file, sc)
+	}
+}
+
+// LookupSharedGroup returns the workspace's shared_examples and
+// shared_context definitions with the given name.
+func (i *Index) LookupSharedGroup(name string) ([]*Range, bool) {
+	var ranges []*Range
+	for _, g := range i.table().sharedGroups[name] {
+		ranges = append(ranges, g.r)
+	}
+	return ranges, len(ranges) > 0
+}
@@ -0,0 +1,254 @@
+package index
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// Column is a database column, which ActiveRecord exposes as attribute
+// methods on the model of its table.
+type Column struct {
+	Table string
+	Name  string
+	// Type is the column type as schema.rb spells it, e.g. string.
+	Type string
+	Null bool
+}
+
+// columnTypes maps column types to the Ruby classes of their values.
+var columnTypes = map[string]string{
+	"string":      "String",
+	"text":        "String",
+	"citext":      "String",
+	"uuid":        "String",
+	"binary":      "String",
+	"integer":     "Integer",
+	"bigint":      "Integer",
+	"primary_key": "Integer",
+	"float":       "Float",
+	"decimal":     "BigDecimal",
+	"boolean":     "bool",
+	"date":        "Date",
+	"datetime":    "ActiveSupport::TimeWithZone",
+	"timestamp":   "ActiveSupport::TimeWithZone",
+	"time":        "ActiveSupport::TimeWithZone",
+	"json":        "Hash[String, untyped]",
+	"jsonb":       "Hash[String, untyped]",
+}
+
+// TableModel maps a table name to its model class by Rails conventions.
+func TableModel(table string) string {
+	return camelize(singularize(table))
+}
+
+func isSchema(path string) bool {
+	return filepath.Base(path) == "schema.rb" && filepath.Base(filepath.Dir(path)) == "db"
+}
+
+// indexSchema indexes the columns of the create_table blocks in
+// db/schema.rb.
+func (i *Index) indexSchema(node parser.Node, file *sourceFile) {
+	if node == nil {
+		return
+	}
+	call, ok := node.(*parser.CallNode)
+	if !ok || call.Name != "create_table" || call.Receiver != nil || call.Arguments == nil {
+		for _, child := range node.Children() {
+			i.indexSchema(child, file)
+		}
+		return
+	}
+	args := call.Arguments.Arguments
+	table := literalName(args[0])
+	block, ok := call.Block.(*parser.BlockNode)
+	if table == "" || !ok {
+		return
+	}
+	options := dslOptions(args[1:])
+	if options["id"] != "false" {
+		// The implicit primary key is defined by the create_table line.
+		typ := options["id"]
+		if typ == "" || typ == "true" {
+			typ = "bigint"
+		}
+		name := options["primary_key"]
+		if name == "" {
+			name = "id"
+		}
+		i.addColumn(Column{Table: table, Name: name, Type: typ}, args[0].Location(), call, file)
+	}
+	body, ok := block.Body.(*parser.StatementsNode)
+	if !ok {
+		return
+	}
+	for _, stmt := range body.Body {
+		c, ok := stmt.(*parser.CallNode)
+		if !ok || c.Receiver == nil {
+			continue
+		}
+		var colArgs []parser.Node
+		if c.Arguments != nil {
+			colArgs = c.Arguments.Arguments
+		}
+		opts := dslOptions(colArgs)
+		null := opts["null"] != "false"
+		switch c.Name {
+		case "timestamps":
+			for _, name := range []string{"created_at", "updated_at"} {
+				i.addColumn(Column{Table: table, Name: name, Type: "datetime", Null: opts["null"] == "true"}, c.Messageloc, c, file)
+			}
+		case "references", "belongs_to":
+			for _, arg := range colArgs {
+				if name := literalName(arg); name != "" {
+					i.addColumn(Column{Table: table, Name: name + "_id", Type: "bigint", Null: null}, arg.Location(), c, file)
+				}
+			}
+		case "column":
+			if len(colArgs) >= 2 {
+				i.addColumn(Column{Table: table, Name: literalName(colArgs[0]), Type: literalName(colArgs[1]), Null: null}, colArgs[0].Location(), c, file)
+			}
+		case "index", "check_constraint":
+		default:
+			for _, arg := range colArgs {
+				if name := literalName(arg); name != "" {
+					i.addColumn(Column{Table: table, Name: name, Type: c.Name, Null: null}, arg.Location(), c, file)
+				}
+			}
+		}
+	}
+}
+
+func literalName(node parser.Node) string {
+	switch n := node.(type) {
+	case *parser.StringNode:
+		return n.Unescaped
+	case *parser.SymbolNode:
+		return n.Unescaped
+	}
+	return ""
+}
+
+func (i *Index) addColumn(c Column, loc *parser.Location, call *parser.CallNode, file *sourceFile) {
+	if c.Name == "" || loc == nil {
+		return
+	}
+	start, err := file.location(int(loc.StartOffset))
+	if err != nil {
+		return
+	}
+	end, err := file.location(int(loc.EndOffset()))
+	if err != nil {
+		return
+	}
+	generator, err := file.span(call.Loc)
+	if err != nil {
+		return
+	}
+	i.columnMethods(c, dslSignature(call, file), &Range{Start: start, End: end}, generator)
+}
+
+// columnMethods declares the attribute methods of a column on its model.
+// generator spans the column's definition.
+func (i *Index) columnMethods(c Column, signature string, r, generator *Range) {
+	class := TableModel(c.Table)
+	typ := columnTypes[c.Type]
+	if typ == "" {
+		typ = "untyped"
+	}
+	if c.Null && typ != "untyped" {
+		typ += "?"
+	}
+	nullability := "not null"
+	if c.Null {
+		nullability = "nullable"
+	}
+	doc := &Doc{Text: "Column `" + c.Name + "` of table `" + c.Table + "`: " + c.Type + ", " + nullability + "."}
+	i.MethodDecls = append(i.MethodDecls,
+		MethodDecl{Name: c.Name, Owner: class, Signature: signature, Doc: doc, Generator: generator, r: r,
+			Types: []MethodType{{Text: "() -> " + typ, Return: typ}}},
+		MethodDecl{Name: c.Name + "=", Owner: class, Signature: signature, Doc: doc, Args: []string{"value"}, Generator: generator, r: r,
+			Types: []MethodType{{Text: "(" + typ + " value) -> " + typ, Params: []TypedParam{{Name: "value", Type: typ}}, Return: typ}}},
+		MethodDecl{Name: c.Name + "?", Owner: class, Signature: signature, Doc: doc, Generator: generator, r: r,
+			Types: []MethodType{{Text: "() -> bool", Return: "bool"}}},
+	)
+}
+
+var (
+	createTableSQL = regexp.MustCompile(`^CREATE TABLE (?:\w+\.)?"?(\w+)"? \($`)
+	columnSQL      = regexp.MustCompile(`^\s+"?(\w+)"? ([a-z][a-z ]*?(?:\(\d+(?:,\d+)?\))?[a-z ]*?(?:\[\])?)(?: DEFAULT .*?)?( NOT NULL)?,?$`)
+)
+
+// sqlTypes maps the PostgreSQL types in structure.sql to schema.rb types.
+var sqlTypes = map[string]string{
+	"character varying":           "string",
+	"text":                        "text",
+	"bigint":                      "bigint",
+	"integer":                     "integer",
+	"smallint":                    "integer",
+	"boolean":                     "boolean",
+	"date":                        "date",
+	"timestamp without time zone": "datetime",
+	"timestamp with time zone":    "datetime",
+	"time without time zone":      "time",
+	"numeric":                     "decimal",
+	"double precision":            "float",
+	"real":                        "float",
+	"json":                        "json",
+	"jsonb":                       "jsonb",
+	"uuid":                        "uuid",
+	"bytea":                       "binary",
+	"citext":                      "citext",
+}
+
+// indexStructureSQL indexes the columns of the CREATE TABLE statements in
+// a db/structure.sql dump.
+func (i *Index) indexStructureSQL(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := NewLineIndex(src)
+	var table string
+	offset := 0
+	for _, raw := range bytes.Split(src, []byte("\n")) {
+		lineStart := offset
+		offset += len(raw) + 1
+		line := strings.TrimSuffix(string(raw), "\r")
+		if m := createTableSQL.FindStringSubmatch(line); m != nil {
+			table = m[1]
+			continue
+		}
+		if table == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ")") {
+			table = ""
+			continue
+		}
+		m := columnSQL.FindStringSubmatchIndex(line)
+		if m == nil || strings.HasPrefix(strings.TrimSpace(line), "CONSTRAINT") {
+			continue
+		}
+		name, sqlType := line[m[2]:m[3]], line[m[4]:m[5]]
+		if k := strings.IndexByte(sqlType, '('); k >= 0 {
+			sqlType = sqlType[:k] + sqlType[strings.IndexByte(sqlType, ')')+1:]
+		}
+		typ, ok := sqlTypes[strings.TrimSpace(sqlType)]
+		if !ok {
+			typ = strings.TrimSpace(sqlType)
+		}
+		startLine, startChar := lines.Position(lineStart + m[2])
+		endLine, endChar := lines.Position(lineStart + m[3])
+		r := &Range{
+			Start: &Location{Line: startLine, Character: startChar, FileURI: path},
+			End:   &Location{Line: endLine, Character: endChar, FileURI: path},
+		}
+		i.columnMethods(Column{Table: table, Name: name, Type: typ, Null: m[6] < 0}, strings.TrimSpace(strings.TrimSuffix(line, ",")), r, r)
+	}
+	return nil
+}
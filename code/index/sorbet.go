@@ -0,0 +1,127 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// sorbetSig is a `sig { ... }` block waiting for the definition it
+// describes.
+type sorbetSig struct {
+	text    string
+	offset  int
+	params  map[string]string
+	returns string
+}
+
+// parseSorbetSig recognises `sig { params(x: Integer).returns(String) }`
+// and its variants (`void`, `override.`, `abstract.`, `sig(:final)`,
+// `T::Sig::WithoutRuntime.sig`).
+func parseSorbetSig(node parser.Node, src []byte) (*sorbetSig, bool) {
+	call, ok := node.(*parser.CallNode)
+	if !ok || call.Name != "sig" {
+		return nil, false
+	}
+	block, ok := call.Block.(*parser.BlockNode)
+	if !ok {
+		return nil, false
+	}
+	loc := call.Loc
+	sig := &sorbetSig{
+		text:   string(src[loc.StartOffset:loc.EndOffset()]),
+		offset: int(loc.StartOffset),
+		params: make(map[string]string),
+	}
+	body, ok := block.Body.(*parser.StatementsNode)
+	if !ok || len(body.Body) == 0 {
+		return sig, true
+	}
+	chain, _ := body.Body[len(body.Body)-1].(*parser.CallNode)
+	for chain != nil {
+		switch chain.Name {
+		case "params":
+			if chain.Arguments != nil {
+				for _, arg := range chain.Arguments.Arguments {
+					hash, ok := arg.(*parser.KeywordHashNode)
+					if !ok {
+						continue
+					}
+					for _, element := range hash.Elements {
+						assoc, ok := element.(*parser.AssocNode)
+						if !ok {
+							continue
+						}
+						key, ok := assoc.Key.(*parser.SymbolNode)
+						if !ok {
+							continue
+						}
+						sig.params[key.Unescaped] = nodeSource(assoc.Value, src)
+					}
+				}
+			}
+		case "returns":
+			if chain.Arguments != nil && len(chain.Arguments.Arguments) > 0 {
+				sig.returns = nodeSource(chain.Arguments.Arguments[0], src)
+			}
+		case "void":
+			sig.returns = "void"
+		}
+		chain, _ = chain.Receiver.(*parser.CallNode)
+	}
+	return sig, true
+}
+
+func nodeSource(node parser.Node, src []byte) string {
+	loc := node.Location()
+	return strings.Join(strings.Fields(string(src[loc.StartOffset:loc.EndOffset()])), " ")
+}
+
+// methodType lines the sig's parameter types up with the parameters of the
+// method definition, which is where their kinds come from.
+func (s *sorbetSig) methodType(params *parser.ParametersNode) MethodType {
+	mt := MethodType{Sig: s.text, Return: s.returns}
+	if params != nil {
+		add := func(kind ParamKind, name string) {
+			mt.Params = append(mt.Params, TypedParam{Name: name, Type: s.params[name], Kind: kind})
+		}
+		for _, n := range params.Requireds {
+			if p, ok := n.(*parser.RequiredParameterNode); ok {
+				add(ParamRequired, p.Name)
+			}
+		}
+		for _, n := range params.Optionals {
+			if p, ok := n.(*parser.OptionalParameterNode); ok {
+				add(ParamOptional, p.Name)
+			}
+		}
+		if p, ok := params.Rest.(*parser.RestParameterNode); ok && p.Name != nil {
+			add(ParamRest, *p.Name)
+		}
+		for _, n := range params.Posts {
+			if p, ok := n.(*parser.RequiredParameterNode); ok {
+				add(ParamRequired, p.Name)
+			}
+		}
+		for _, n := range params.Keywords {
+			switch p := n.(type) {
+			case *parser.RequiredKeywordParameterNode:
+				add(ParamKeyword, p.Name)
+			case *parser.OptionalKeywordParameterNode:
+				add(ParamOptionalKeyword, p.Name)
+			}
+		}
+		if p, ok := params.Keywordrest.(*parser.KeywordRestParameterNode); ok && p.Name != nil {
+			add(ParamKeywordRest, *p.Name)
+		}
+		if params.Block != nil && params.Block.Name != nil {
+			add(ParamBlock, *params.Block.Name)
+		}
+	}
+	labels := make([]string, 0, len(mt.Params))
+	for _, p := range mt.Params {
+		labels = append(labels, p.Label())
+	}
+	mt.Text = "(" + strings.Join(labels, ", ") + ") -> " + s.returns
+	return mt
+}
@@ -0,0 +1,275 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// symbolTable keys the declarations of an index by name. It is built once
+// indexing has finished and points into the decl slices, which must not
+// grow afterwards.
+type symbolTable struct {
+	// constants holds modules, classes and constants by unqualified name.
+	constants map[string][]Node
+	// members holds modules, classes and constants by Owner.
+	members map[string][]Node
+	classes map[string][]*ClassDecl
+	modules map[string][]*ModuleDecl
+	methods map[string][]*MethodDecl
+	// owners holds methods by Owner, with "." appended for singleton
+	// methods.
+	owners map[string][]*MethodDecl
+	// references holds references by unqualified name.
+	references map[string][]*Reference
+	// variables holds instance and class variables by Owner.
+	variables map[string][]*VariableDecl
+	// sharedGroups holds RSpec shared groups by name.
+	sharedGroups map[string][]*SharedGroup
+	// tasks holds Rake tasks by qualified name.
+	tasks map[string][]*RakeTask
+	// defined holds the full names of the modules, classes and constants
+	// declared in each file, by path.
+	defined map[string][]string
+	// constantNames and methodNames are sorted and unique, for prefix
+	// searches.
+	constantNames []string
+	methodNames   []string
+	// resolved caches the files requires load, by requireKey. The files
+	// of a snapshot are not expected to move while it is current.
+	resolved sync.Map
+}
+
+// interner deduplicates the names and paths shared by many declarations.
+type interner map[string]string
+
+func (in interner) intern(s string) string {
+	if v, ok := in[s]; ok {
+		return v
+	}
+	in[s] = s
+	return s
+}
+
+func (in interner) internRange(r *Range) {
+	if r == nil {
+		return
+	}
+	if r.Start != nil {
+		r.Start.FileURI = in.intern(r.Start.FileURI)
+	}
+	if r.End != nil {
+		r.End.FileURI = in.intern(r.End.FileURI)
+	}
+}
+
+func ownerKey(owner string, singleton bool) string {
+	if singleton {
+		return owner + "."
+	}
+	return owner
+}
+
+// finish interns the declarations, builds the symbol table and marks the
+// index ready for lookups.
+func (i *Index) finish() {
+	in := make(interner)
+	t := &symbolTable{
+		constants:    make(map[string][]Node),
+		members:      make(map[string][]Node),
+		classes:      make(map[string][]*ClassDecl),
+		modules:      make(map[string][]*ModuleDecl),
+		methods:      make(map[string][]*MethodDecl),
+		owners:       make(map[string][]*MethodDecl),
+		references:   make(map[string][]*Reference),
+		variables:    make(map[string][]*VariableDecl),
+		sharedGroups: make(map[string][]*SharedGroup),
+		tasks:        make(map[string][]*RakeTask),
+		defined:      make(map[string][]string),
+	}
+	for k := range i.ModuleDecls {
+		m := &i.ModuleDecls[k]
+		m.Name, m.Owner = in.intern(m.Name), in.intern(m.Owner)
+		in.internRange(m.r)
+		t.constants[m.Name] = append(t.constants[m.Name], m)
+		t.members[m.Owner] = append(t.members[m.Owner], m)
+		t.modules[m.FullName()] = append(t.modules[m.FullName()], m)
+		t.define(m.r, m.FullName())
+	}
+	for k := range i.ClassDecls {
+		c := &i.ClassDecls[k]
+		c.Name, c.Owner, c.Superclass = in.intern(c.Name), in.intern(c.Owner), in.intern(c.Superclass)
+		in.internRange(c.r)
+		t.constants[c.Name] = append(t.constants[c.Name], c)
+		t.members[c.Owner] = append(t.members[c.Owner], c)
+		t.classes[c.FullName()] = append(t.classes[c.FullName()], c)
+		t.define(c.r, c.FullName())
+	}
+	for k := range i.ConstantDecls {
+		c := &i.ConstantDecls[k]
+		c.Name, c.Owner = in.intern(c.Name), in.intern(c.Owner)
+		in.internRange(c.r)
+		t.constants[c.Name] = append(t.constants[c.Name], c)
+		t.members[c.Owner] = append(t.members[c.Owner], c)
+		t.define(c.r, c.FullName())
+	}
+	for k := range i.MethodDecls {
+		m := &i.MethodDecls[k]
+		m.Name, m.Owner = in.intern(m.Name), in.intern(m.Owner)
+		in.internRange(m.r)
+		in.internRange(m.Generator)
+		t.methods[m.Name] = append(t.methods[m.Name], m)
+		key := ownerKey(m.Owner, m.Singleton)
+		t.owners[key] = append(t.owners[key], m)
+	}
+	for k := range i.References {
+		r := &i.References[k]
+		r.Name, r.Scope, r.Method = in.intern(r.Name), in.intern(r.Scope), in.intern(r.Method)
+		in.internRange(r.r)
+		t.references[r.Name] = append(t.references[r.Name], r)
+	}
+	for k := range i.VariableDecls {
+		v := &i.VariableDecls[k]
+		v.Name, v.Owner, v.Method = in.intern(v.Name), in.intern(v.Owner), in.intern(v.Method)
+		in.internRange(v.r)
+		t.variables[v.Owner] = append(t.variables[v.Owner], v)
+	}
+	for k := range i.SharedGroups {
+		g := &i.SharedGroups[k]
+		g.Name = in.intern(g.Name)
+		in.internRange(g.r)
+		t.sharedGroups[g.Name] = append(t.sharedGroups[g.Name], g)
+	}
+	for k := range i.Tasks {
+		task := &i.Tasks[k]
+		task.Name = in.intern(task.Name)
+		in.internRange(task.r)
+		t.tasks[task.Name] = append(t.tasks[task.Name], task)
+	}
+	t.constantNames = sortedKeys(t.constants)
+	t.methodNames = sortedKeys(t.methods)
+	i.symbols = t
+	i.Indexed = true
+}
+
+// define records name under the file of r.
+func (t *symbolTable) define(r *Range, name string) {
+	if r != nil && r.Start != nil {
+		t.defined[r.Start.FileURI] = append(t.defined[r.Start.FileURI], name)
+	}
+}
+
+// noSymbols is the table of indexes that were never finished.
+var noSymbols = &symbolTable{}
+
+// table returns the symbol table built by finish. Indexes are finished
+// before they are shared, so it is never built on the read path.
+func (i *Index) table() *symbolTable {
+	if i.symbols == nil {
+		return noSymbols
+	}
+	return i.symbols
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// withPrefix returns the names in the sorted slice starting with prefix.
+func withPrefix(names []string, prefix string) []string {
+	start := sort.SearchStrings(names, prefix)
+	end := start
+	for end < len(names) && strings.HasPrefix(names[end], prefix) {
+		end++
+	}
+	return names[start:end]
+}
+
+// ConstantNames returns the unqualified names of the modules, classes and
+// constants starting with prefix, in every layer, sorted.
+func (i *Index) ConstantNames(prefix string) []string {
+	var names []string
+	for _, l := range i.layers() {
+		names = append(names, withPrefix(l.table().constantNames, prefix)...)
+	}
+	return uniqueSorted(names)
+}
+
+// MethodNames returns the names of the methods starting with prefix, in
+// every layer, sorted.
+func (i *Index) MethodNames(prefix string) []string {
+	var names []string
+	for _, l := range i.layers() {
+		names = append(names, withPrefix(l.table().methodNames, prefix)...)
+	}
+	return uniqueSorted(names)
+}
+
+func uniqueSorted(names []string) []string {
+	sort.Strings(names)
+	res := names[:0]
+	for k, n := range names {
+		if k == 0 || n != names[k-1] {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// Search returns up to limit workspace declarations whose qualified names
+// contain query, ignoring case: Rake tasks, then modules, classes and
+// constants, then methods.
+func (i *Index) Search(query string, limit int) []Node {
+	query = strings.ToLower(query)
+	t := i.table()
+	var res []Node
+	add := func(name string, n Node) bool {
+		if strings.Contains(strings.ToLower(name), query) {
+			res = append(res, n)
+		}
+		return len(res) < limit
+	}
+	for _, name := range sortedKeys(t.tasks) {
+		for _, task := range t.tasks[name] {
+			if !add(task.Name, task) {
+				return res
+			}
+		}
+	}
+	for _, name := range t.constantNames {
+		for _, n := range t.constants[name] {
+			if !add(qualifiedName(n), n) {
+				return res
+			}
+		}
+	}
+	for _, name := range t.methodNames {
+		for _, m := range t.methods[name] {
+			if !add(m.FullName(), m) {
+				return res
+			}
+		}
+	}
+	return res
+}
+
+func qualifiedName(n Node) string {
+	switch d := n.(type) {
+	case *ModuleDecl:
+		return d.FullName()
+	case *ClassDecl:
+		return d.FullName()
+	case *ConstantDecl:
+		return d.FullName()
+	case *MethodDecl:
+		return d.FullName()
+	case *RakeTask:
+		return d.Name
+	}
+	return ""
+}
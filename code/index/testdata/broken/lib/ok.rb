@@ -0,0 +1,4 @@
+class Ok
+  def fine
+  end
+end
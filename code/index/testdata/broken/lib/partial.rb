@@ -0,0 +1,7 @@
+module Partial
+  def valid
+  end
+
+  def broken(
+  end
+end
@@ -0,0 +1,3 @@
+class Unclosed
+  def before_eof
+  end
@@ -0,0 +1,33 @@
+# frozen_string_literal: true
+
+# Payments are processed by the gateway configured for the account.
+module Payments
+  # Default currency used when none is given.
+  DEFAULT_CURRENCY = "GBP"
+
+  # Charges an account through the gateway.
+  #
+  # @example Charging an account
+  #   Payments::Charge.new(account).call(100)
+  class Charge < Base
+    # Performs the charge.
+    #
+    # @param amount [Integer] amount in minor units
+    # @param [String] currency ISO currency code
+    #   defaulting to GBP
+    # @return [Receipt, nil] the receipt when the charge succeeds
+    # @raise [GatewayError] if the gateway rejects the charge
+    def call(amount, currency = DEFAULT_CURRENCY)
+    end
+
+    # @deprecated Use {#call} instead.
+    def self.charge!(amount)
+    end
+
+    class << self
+      def gateway; end
+    end
+
+    def undocumented; end
+  end
+end
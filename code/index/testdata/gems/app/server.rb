@@ -0,0 +1,6 @@
+# frozen_string_literal: true
+
+class Server
+  def params
+  end
+end
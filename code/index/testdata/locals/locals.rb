@@ -0,0 +1,25 @@
+total = 0
+
+class Report
+  header = "report"
+
+  def render(rows, title = nil, *rest, width:, height: 10, **opts, &blk)
+    count = 0
+    rows.each do |row; buffer|
+      count += 1
+      buffer = row.to_s
+      cells = row.map { _1.upcase }
+      names = row.map { it.name }
+    end
+    begin
+      process(count)
+    rescue ArgumentError => error
+      warn error.message
+    end
+    case title
+    in { name: String => label, size: }
+      label
+    end
+    first, second = rows
+  end
+end
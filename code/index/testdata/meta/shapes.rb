@@ -0,0 +1,22 @@
+module Shapes
+  Point = Struct.new(:x, :y) do
+    def distance; end
+  end
+
+  Coord = Data.define(:lat, :lng)
+
+  class Size < Struct.new(:width, :height)
+  end
+
+  class Invoice
+    STATES = %i[draft sent].freeze
+
+    %i[draft sent].each do |state|
+      define_method("#{state}?") { status == state }
+      define_method(:"mark_#{state}!") { |at| update(state, at) }
+    end
+
+    define_method(:total) { 0 }
+    define_singleton_method(:build) { |attrs| new }
+  end
+end
@@ -0,0 +1,2 @@
+class Error < StandardError
+end
@@ -0,0 +1,24 @@
+module Payments
+  class Error < ::Error
+  end
+
+  module Gateway
+    TIMEOUT = 30
+
+    class Base
+      RETRIES = 3
+    end
+  end
+
+  class Charge < Gateway::Base
+    def call
+      raise Error if RETRIES > Gateway::TIMEOUT
+    end
+  end
+end
+
+class Payments::Refund
+  def call
+    Error
+  end
+end
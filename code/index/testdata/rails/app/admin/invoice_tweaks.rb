@@ -0,0 +1,6 @@
+module Billing
+  class Invoice
+    def admin_url
+    end
+  end
+end
@@ -0,0 +1,5 @@
+module Billing
+  class Invoice
+    include Priceable
+  end
+end
@@ -0,0 +1,4 @@
+module Priceable
+  def price
+  end
+end
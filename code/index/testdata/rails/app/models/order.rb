@@ -0,0 +1,14 @@
+class Order < ApplicationRecord
+  # The customer placing the order.
+  belongs_to :account
+  has_many :line_items, dependent: :destroy
+  has_many :addresses, class_name: "PostalAddress"
+  has_one :invoice, class_name: "Billing::Invoice"
+
+  scope :active, -> { where(active: true) }
+  scope :placed_after, ->(time) { where("placed_at > ?", time) }
+
+  delegate :name, :email, to: :account
+  delegate :total, to: :invoice, prefix: true
+  delegate :city, to: :shipping_address, prefix: :shipping, allow_nil: true
+end
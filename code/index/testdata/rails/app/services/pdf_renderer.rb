@@ -0,0 +1 @@
+Object.const_set(:PdfRenderer, Class.new)
@@ -0,0 +1,14 @@
+ActiveRecord::Schema[7.1].define(version: 2024_05_01_120000) do
+  create_table "orders", force: :cascade do |t|
+    t.references :account, null: false
+    t.string "reference", null: false
+    t.decimal "total", precision: 10, scale: 2
+    t.boolean "gift"
+    t.timestamps null: false
+    t.index ["reference"], unique: true
+  end
+
+  create_table "line_items", id: :uuid do |t|
+    t.column "quantity", :integer, null: false
+  end
+end
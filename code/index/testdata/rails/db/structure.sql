@@ -0,0 +1,7 @@
+CREATE TABLE public.shipments (
+    id bigint NOT NULL,
+    carrier character varying(255) DEFAULT 'post'::character varying NOT NULL,
+    weight numeric(10,2),
+    delivered_at timestamp(6) without time zone,
+    CONSTRAINT weight_positive CHECK ((weight > 0))
+);
@@ -0,0 +1,15 @@
+# frozen_string_literal: true
+
+module Billing
+  class Invoice
+    attr_reader :total
+
+    def initialize(total)
+      @total = total
+    end
+
+    # Adds a line to the invoice.
+    def add_line(description, amount, tax: nil)
+    end
+  end
+end
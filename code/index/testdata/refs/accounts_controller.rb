@@ -0,0 +1,18 @@
+class AccountsController < ApplicationController
+  before_action :authenticate, only: [:show]
+  after_action :audit, if: :signed_in?
+
+  def show
+    account = Account.find(params[:id])
+    self.render_account(account)
+    super
+  end
+
+  def render_account(account)
+    Billing::Ledger.for(account).render_account
+  end
+
+  private
+
+  def authenticate; end
+end
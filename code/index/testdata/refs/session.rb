@@ -0,0 +1,25 @@
+class Base
+  def initialize
+    @created_at = Time.now
+  end
+end
+
+class Session < Base
+  @@count = 0
+  @registry = {}
+
+  class << self
+    def track
+      @tracked ||= []
+    end
+  end
+
+  def self.reset
+    @@count = 0
+  end
+
+  def login(user)
+    @user, @token = user, nil
+    @attempts += 1
+  end
+end
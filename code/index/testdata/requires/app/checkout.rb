@@ -0,0 +1,6 @@
+require "json"
+require "pricing"
+require_relative "../lib/pricing"
+load "./config/setup.rb"
+
+class Checkout; end
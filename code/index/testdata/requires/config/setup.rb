@@ -0,0 +1 @@
+SETUP = true
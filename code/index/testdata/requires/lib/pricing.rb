@@ -0,0 +1,3 @@
+module Pricing
+  autoload :Tax, "pricing/tax"
+end
@@ -0,0 +1,3 @@
+module Pricing
+  class Tax; end
+end
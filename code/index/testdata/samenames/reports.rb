@@ -0,0 +1,29 @@
+module Billing
+  class Report
+    def self.build; end
+
+    def total; end
+
+    def summary
+      total
+    end
+  end
+
+  class Invoice
+    def render
+      Report.build
+      ::Report.build
+      Billing::Report.new
+    end
+  end
+end
+
+class Report
+  def self.build; end
+
+  def total; end
+
+  def print
+    total
+  end
+end
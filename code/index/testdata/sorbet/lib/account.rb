@@ -0,0 +1,29 @@
+# typed: strict
+# frozen_string_literal: true
+
+class Account
+  extend T::Sig
+
+  sig { returns(String) }
+  attr_reader :name
+
+  # Deposits money into the account.
+  sig { params(amount: Integer, note: T.nilable(String), block: T.proc.void).returns(T::Boolean) }
+  def deposit(amount, note: nil, &block)
+  end
+
+  sig do
+    override
+      .params(other: Account)
+      .void
+  end
+  def merge!(other)
+  end
+
+  sig { returns(Integer) }
+  CONSTANT_AFTER_SIG = 1
+
+  def untyped; end
+
+  def balance; end
+end
@@ -0,0 +1,7 @@
+# typed: true
+
+# Money represents an amount in a currency.
+class Money
+  sig { params(cents: Integer, currency: String).void }
+  def initialize(cents, currency); end
+end
@@ -0,0 +1,6 @@
+# typed: strict
+
+class Account
+  sig { returns(Money) }
+  def balance; end
+end
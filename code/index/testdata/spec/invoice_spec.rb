@@ -0,0 +1,22 @@
+RSpec.describe Invoice, type: :model do
+  let(:invoice) { build(:invoice) }
+  subject { invoice.total }
+
+  describe "#total" do
+    let!(:invoice) { create(:invoice, lines: 2) }
+
+    before { invoice.recalculate }
+
+    it "sums the lines" do
+      expect(invoice.total).to eq(20)
+    end
+
+    context "when empty" do
+      it { expect(invoice).to be_empty }
+    end
+  end
+
+  it_behaves_like "a payable"
+
+  def helper; end
+end
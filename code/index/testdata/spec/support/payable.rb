@@ -0,0 +1,5 @@
+RSpec.shared_examples "a payable" do
+  it "can be paid" do
+    expect(subject).to respond_to(:pay)
+  end
+end
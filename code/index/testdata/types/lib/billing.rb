@@ -0,0 +1,24 @@
+module Billing
+  class Customer
+    # @return [String]
+    def name
+    end
+  end
+
+  class Invoice
+    extend Finders
+
+    # @return [Customer, nil]
+    def customer
+    end
+
+    def total
+    end
+
+    def self.find(id)
+    end
+  end
+
+  class Money
+  end
+end
@@ -0,0 +1,4 @@
+module Finders
+  def where(conditions)
+  end
+end
@@ -0,0 +1,34 @@
+class Ledger
+  def balance
+  end
+
+  private def reconcile
+  end
+
+  def self.open
+  end
+
+  protected
+
+  def entries
+  end
+
+  private
+
+  def self.load
+  end
+
+  def audit
+  end
+
+  def export
+  end
+  public :export
+
+  class << self
+    private
+
+    def cache
+    end
+  end
+end
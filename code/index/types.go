@@ -0,0 +1,531 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// Type is an inferred type: an instance of the class or module Name, or
+// the class or module object itself when Singleton is set.
+type Type struct {
+	Name      string
+	Singleton bool
+}
+
+func (t Type) String() string {
+	if t.Singleton {
+		return "singleton(" + t.Name + ")"
+	}
+	return t.Name
+}
+
+// literalType returns the class of a literal node, or "".
+func literalType(node parser.Node) string {
+	switch node.(type) {
+	case *parser.StringNode, *parser.InterpolatedStringNode, *parser.XStringNode, *parser.InterpolatedXStringNode:
+		return "String"
+	case *parser.SymbolNode, *parser.InterpolatedSymbolNode:
+		return "Symbol"
+	case *parser.IntegerNode:
+		return "Integer"
+	case *parser.FloatNode:
+		return "Float"
+	case *parser.RationalNode:
+		return "Rational"
+	case *parser.ImaginaryNode:
+		return "Complex"
+	case *parser.ArrayNode:
+		return "Array"
+	case *parser.HashNode, *parser.KeywordHashNode:
+		return "Hash"
+	case *parser.RangeNode:
+		return "Range"
+	case *parser.RegularExpressionNode, *parser.InterpolatedRegularExpressionNode:
+		return "Regexp"
+	case *parser.LambdaNode:
+		return "Proc"
+	case *parser.NilNode:
+		return "NilClass"
+	case *parser.TrueNode:
+		return "TrueClass"
+	case *parser.FalseNode:
+		return "FalseClass"
+	}
+	return ""
+}
+
+// selfSpan is a class, module or method body, what self is in it and
+// in the methods defined directly in it.
+type selfSpan struct {
+	start, end int
+	self, defs Type
+	nesting    []string
+}
+
+// inference infers the types of the expressions of one document. It is
+// local and flow-insensitive: a variable has the union of the types of
+// everything assigned to it anywhere in its scope.
+type inference struct {
+	idx     *Index
+	locals  *LocalScope
+	assigns map[*LocalVar][]parser.Node
+	ivars   map[Type]map[string][]parser.Node
+	spans   []selfSpan
+	busy    map[any]bool
+}
+
+// Inference keeps what a parsed document tells about the types of its
+// expressions, so that it is parsed once for any number of queries. It is
+// not safe for concurrent use.
+type Inference struct {
+	root    parser.Node
+	in      *inference
+	results map[parser.Node][]Type
+}
+
+// Infer parses src for TypeAt queries. It returns nil when src cannot be
+// parsed.
+func (i *Index) Infer(src []byte) *Inference {
+	result, err := parseDocument(src)
+	if err != nil {
+		return nil
+	}
+	in := &inference{
+		idx:     i,
+		locals:  AnalyzeLocals(result.Value),
+		assigns: make(map[*LocalVar][]parser.Node),
+		ivars:   make(map[Type]map[string][]parser.Node),
+		busy:    make(map[any]bool),
+	}
+	top := Type{Name: "Object"}
+	in.collect(result.Value, selfSpan{end: len(src), self: top, defs: top})
+	return &Inference{root: result.Value, in: in, results: make(map[parser.Node][]Type)}
+}
+
+// TypeAt infers the types of the expression that ends at offset, such as
+// the receiver before a `.`. It returns nil when nothing is known.
+func (f *Inference) TypeAt(offset int) []Type {
+	if f == nil {
+		return nil
+	}
+	expr := expressionEndingAt(f.root, offset)
+	if expr == nil {
+		return nil
+	}
+	if types, ok := f.results[expr]; ok {
+		return types
+	}
+	types := f.in.infer(expr)
+	f.results[expr] = types
+	return types
+}
+
+// TypeAt infers the types of the expression in src that ends at offset.
+func (i *Index) TypeAt(src []byte, offset int) []Type {
+	return i.Infer(src).TypeAt(offset)
+}
+
+// expressionEndingAt returns the smallest node that ends at offset.
+func expressionEndingAt(node parser.Node, offset int) parser.Node {
+	if node == nil {
+		return nil
+	}
+	loc := node.Location()
+	if loc == nil || int(loc.StartOffset) > offset || int(loc.EndOffset()) < offset {
+		return nil
+	}
+	for _, c := range node.Children() {
+		if found := expressionEndingAt(c, offset); found != nil {
+			return found
+		}
+	}
+	switch node.(type) {
+	case *parser.StatementsNode, *parser.ProgramNode, *parser.ArgumentsNode:
+		return nil
+	}
+	if int(loc.EndOffset()) == offset {
+		return node
+	}
+	return nil
+}
+
+// collect records the assignments of the document and what self is in
+// each class, module and method body.
+func (in *inference) collect(node parser.Node, span selfSpan) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *parser.ClassNode:
+		in.collectNamespace(n.Constantpath, n.Body, n.Loc, span)
+		in.collect(n.Superclass, span)
+		return
+	case *parser.ModuleNode:
+		in.collectNamespace(n.Constantpath, n.Body, n.Loc, span)
+		return
+	case *parser.SingletonClassNode:
+		if _, ok := n.Expression.(*parser.SelfNode); ok {
+			singleton := Type{Name: span.self.Name, Singleton: true}
+			in.collect(n.Body, in.span(n.Loc, singleton, singleton, span.nesting))
+			return
+		}
+	case *parser.DefNode:
+		self := span.defs
+		if _, ok := n.Receiver.(*parser.SelfNode); ok {
+			self = span.self
+		}
+		inner := in.span(n.Loc, self, self, span.nesting)
+		in.collect(n.Parameters, inner)
+		in.collect(n.Body, inner)
+		return
+	case *parser.LocalVariableWriteNode:
+		in.assign(n.Name, n.Nameloc, n.Value)
+	case *parser.LocalVariableOrWriteNode:
+		in.assign(n.Name, n.Nameloc, n.Value)
+	case *parser.OptionalParameterNode:
+		in.assign(n.Name, n.Nameloc, n.Value)
+	case *parser.OptionalKeywordParameterNode:
+		in.assign(n.Name, n.Nameloc, n.Value)
+	case *parser.InstanceVariableWriteNode:
+		in.assignIvar(span.self, n.Name, n.Value)
+	case *parser.InstanceVariableOrWriteNode:
+		in.assignIvar(span.self, n.Name, n.Value)
+	}
+	for _, c := range node.Children() {
+		in.collect(c, span)
+	}
+}
+
+func (in *inference) collectNamespace(path, body parser.Node, loc *parser.Location, span selfSpan) {
+	name := constantPath(path)
+	if strings.HasPrefix(name, "::") || len(span.nesting) == 0 {
+		name = strings.TrimPrefix(name, "::")
+	} else {
+		name = span.nesting[0] + "::" + name
+	}
+	nesting := append([]string{name}, span.nesting...)
+	in.collect(body, in.span(loc, Type{Name: name, Singleton: true}, Type{Name: name}, nesting))
+}
+
+func (in *inference) span(loc *parser.Location, self, defs Type, nesting []string) selfSpan {
+	s := selfSpan{start: int(loc.StartOffset), end: int(loc.EndOffset()), self: self, defs: defs, nesting: nesting}
+	in.spans = append(in.spans, s)
+	return s
+}
+
+func (in *inference) assign(name string, loc *parser.Location, value parser.Node) {
+	if loc == nil || value == nil {
+		return
+	}
+	if l := in.locals.Lookup(name, int(loc.StartOffset)); l != nil {
+		in.assigns[l] = append(in.assigns[l], value)
+	}
+}
+
+func (in *inference) assignIvar(self Type, name string, value parser.Node) {
+	if in.ivars[self] == nil {
+		in.ivars[self] = make(map[string][]parser.Node)
+	}
+	in.ivars[self][name] = append(in.ivars[self][name], value)
+}
+
+// at returns the innermost class, module or method body around offset.
+func (in *inference) at(offset int) selfSpan {
+	res := selfSpan{self: Type{Name: "Object"}}
+	for _, s := range in.spans {
+		if s.start <= offset && offset <= s.end && s.start >= res.start {
+			res = s
+		}
+	}
+	return res
+}
+
+func (in *inference) infer(node parser.Node) []Type {
+	if name := literalType(node); name != "" {
+		return []Type{{Name: name}}
+	}
+	offset := int(node.Location().StartOffset)
+	switch n := node.(type) {
+	case *parser.ParenthesesNode:
+		return in.inferLast(n.Body)
+	case *parser.StatementsNode:
+		return in.inferLast(n)
+	case *parser.SelfNode:
+		return []Type{in.at(offset).self}
+	case *parser.ConstantReadNode, *parser.ConstantPathNode:
+		full, nodes, ok := in.idx.ResolveConstant(constantPath(n), in.at(offset).nesting)
+		if !ok {
+			return nil
+		}
+		for _, d := range nodes {
+			if d.Type() == NodeClass || d.Type() == NodeModule {
+				return []Type{{Name: full, Singleton: true}}
+			}
+		}
+	case *parser.LocalVariableReadNode:
+		l := in.locals.Lookup(n.Name, offset)
+		if l == nil || in.busy[l] {
+			return nil
+		}
+		in.busy[l] = true
+		defer delete(in.busy, l)
+		var res []Type
+		for _, v := range in.assigns[l] {
+			res = appendTypes(res, in.infer(v)...)
+		}
+		return res
+	case *parser.InstanceVariableReadNode:
+		self := in.at(offset).self
+		key := self.String() + n.Name
+		if in.busy[key] {
+			return nil
+		}
+		in.busy[key] = true
+		defer delete(in.busy, key)
+		var res []Type
+		for _, v := range in.ivars[self][n.Name] {
+			res = appendTypes(res, in.infer(v)...)
+		}
+		return res
+	case *parser.LocalVariableWriteNode:
+		return in.infer(n.Value)
+	case *parser.InstanceVariableWriteNode:
+		return in.infer(n.Value)
+	case *parser.CallNode:
+		return in.inferCall(n)
+	}
+	return nil
+}
+
+func (in *inference) inferLast(node parser.Node) []Type {
+	if s, ok := node.(*parser.StatementsNode); ok {
+		if len(s.Body) == 0 {
+			return nil
+		}
+		return in.infer(s.Body[len(s.Body)-1])
+	}
+	if node == nil {
+		return nil
+	}
+	return in.infer(node)
+}
+
+func (in *inference) inferCall(n *parser.CallNode) []Type {
+	var receivers []Type
+	if n.Receiver == nil {
+		receivers = []Type{in.at(int(n.Loc.StartOffset)).self}
+	} else {
+		receivers = in.infer(n.Receiver)
+	}
+	var res []Type
+	for _, r := range receivers {
+		switch {
+		case r.Singleton && n.Name == "new":
+			res = appendTypes(res, Type{Name: r.Name})
+			continue
+		case n.Name == "class" && !r.Singleton:
+			res = appendTypes(res, Type{Name: r.Name, Singleton: true})
+			continue
+		}
+		res = appendTypes(res, in.idx.ReturnTypes(r, n.Name)...)
+	}
+	return res
+}
+
+// ReturnTypes returns the types the method name called on a receiver of
+// type t is declared to return, from its RBS, Sorbet or YARD types.
+func (i *Index) ReturnTypes(t Type, name string) []Type {
+	for _, m := range i.MethodsFor(t, name) {
+		var declared []string
+		for _, mt := range m.Types {
+			if mt.Return != "" {
+				declared = append(declared, mt.Return)
+			}
+		}
+		if len(declared) == 0 && m.Doc != nil && m.Doc.Return != nil {
+			declared = m.Doc.Return.Types
+		}
+		if len(declared) == 0 {
+			continue
+		}
+		var res []Type
+		for _, d := range declared {
+			res = appendTypes(res, i.parseType(d, t, namespaces(m.Owner))...)
+		}
+		return res
+	}
+	return nil
+}
+
+// MethodsFor returns the methods called name that a receiver of type t
+// responds to, nearest ancestor first.
+func (i *Index) MethodsFor(t Type, name string) []*MethodDecl {
+	var res []*MethodDecl
+	for _, o := range i.methodOwners(t) {
+		for _, m := range i.MethodsOf(o.Name, o.Singleton) {
+			if m.Name == name {
+				res = append(res, m)
+			}
+		}
+	}
+	return res
+}
+
+// MethodsOn returns the methods a receiver of type t responds to, one per
+// name, nearest ancestor first.
+func (i *Index) MethodsOn(t Type) []*MethodDecl {
+	var res []*MethodDecl
+	seen := make(map[string]bool)
+	for _, o := range i.methodOwners(t) {
+		for _, m := range i.MethodsOf(o.Name, o.Singleton) {
+			if !seen[m.Name] {
+				seen[m.Name] = true
+				res = append(res, m)
+			}
+		}
+	}
+	return res
+}
+
+// methodOwners returns where methods called on a receiver of type t are
+// looked up, nearest first. Class methods come from the class and its
+// superclasses, each followed by the modules it extends and their
+// ancestors, and fall back to the instance methods of Class or Module.
+func (i *Index) methodOwners(t Type) []Type {
+	if !t.Singleton {
+		return mapp(i.Ancestors(t.Name), func(a string) Type { return Type{Name: a} })
+	}
+	var res []Type
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			res = append(res, Type{Name: name})
+		}
+	}
+	for _, a := range i.Ancestors(t.Name) {
+		if a != t.Name && !i.isClass(a) {
+			continue
+		}
+		res = append(res, Type{Name: a, Singleton: true})
+		extends := i.extends(a)
+		for k := len(extends) - 1; k >= 0; k-- {
+			for _, e := range i.Ancestors(extends[k]) {
+				add(e)
+			}
+		}
+	}
+	meta := "Module"
+	if i.isClass(t.Name) {
+		meta = "Class"
+	}
+	for _, a := range i.Ancestors(meta) {
+		add(a)
+	}
+	return res
+}
+
+// extends returns the fully qualified names of the modules the class or
+// module called name extends, in the order they are extended.
+func (i *Index) extends(name string) []string {
+	var res []string
+	for _, l := range i.layers() {
+		for _, c := range l.table().classes[name] {
+			for _, e := range c.Extends {
+				res = append(res, i.qualifyIn(c.Owner, e))
+			}
+		}
+		for _, m := range l.table().modules[name] {
+			for _, e := range m.Extends {
+				res = append(res, i.qualifyIn(m.Owner, e))
+			}
+		}
+	}
+	return res
+}
+
+func (i *Index) isClass(name string) bool {
+	for _, l := range i.layers() {
+		if len(l.table().classes[name]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseType reads an RBS, Sorbet or YARD type written in the namespace of
+// nesting. self stands for the receiver the method was called on.
+func (i *Index) parseType(text string, self Type, nesting []string) []Type {
+	text = strings.TrimSpace(text)
+	if strings.ContainsAny(text, "|") && !strings.ContainsAny(text, "[<(") {
+		var res []Type
+		for _, part := range strings.Split(text, "|") {
+			res = appendTypes(res, i.parseType(part, self, nesting)...)
+		}
+		return res
+	}
+	if inner, ok := strings.CutPrefix(text, "T.nilable("); ok {
+		return i.parseType(strings.TrimSuffix(inner, ")"), self, nesting)
+	}
+	if inner, ok := strings.CutPrefix(text, "singleton("); ok {
+		res := i.parseType(strings.TrimSuffix(inner, ")"), self, nesting)
+		for k := range res {
+			res[k].Singleton = true
+		}
+		return res
+	}
+	text = strings.TrimSuffix(text, "?")
+	if k := strings.IndexAny(text, "[<"); k > 0 {
+		text = text[:k]
+	}
+	switch text {
+	case "self", "T.self_type":
+		return []Type{self}
+	case "instance", "T.attached_class":
+		return []Type{{Name: self.Name}}
+	case "bool", "boolish", "Boolean", "T::Boolean":
+		return []Type{{Name: "TrueClass"}, {Name: "FalseClass"}}
+	case "nil", "NilClass":
+		return []Type{{Name: "NilClass"}}
+	case "T::Array":
+		return []Type{{Name: "Array"}}
+	case "T::Hash":
+		return []Type{{Name: "Hash"}}
+	case "T::Set":
+		return []Type{{Name: "Set"}}
+	case "void", "untyped", "T.untyped", "top", "bot", "Object", "":
+		return nil
+	}
+	if text[0] < 'A' || text[0] > 'Z' {
+		if !strings.HasPrefix(text, "::") {
+			return nil
+		}
+	}
+	if full, _, ok := i.ResolveConstant(text, nesting); ok {
+		return []Type{{Name: full}}
+	}
+	return []Type{{Name: strings.TrimPrefix(text, "::")}}
+}
+
+// namespaces returns owner and the namespaces around it, innermost first.
+func namespaces(owner string) []string {
+	var res []string
+	for owner != "" {
+		res = append(res, owner)
+		owner, _, _ = cutLast(owner, "::")
+	}
+	return res
+}
+
+func appendTypes(res []Type, types ...Type) []Type {
+	for _, t := range types {
+		found := false
+		for _, r := range res {
+			found = found || r == t
+		}
+		if !found {
+			res = append(res, t)
+		}
+	}
+	return res
+}
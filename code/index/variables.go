@@ -0,0 +1,117 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/tjgurwara99/go-ruby-prism/parser"
+)
+
+// VariableDecl is an assignment to an instance or class variable. Name
+// keeps its sigil, so class variables start with "@@".
+type VariableDecl struct {
+	Name  string
+	Owner string
+	// Singleton is set for instance variables of the class object itself,
+	// assigned in the class body or in singleton methods.
+	Singleton bool
+	// Method is the method the assignment appears in, if any.
+	Method string
+	r      *Range
+}
+
+// Range implements Node.
+func (v *VariableDecl) Range() *Range {
+	return v.r
+}
+
+// Type implements Node.
+func (v *VariableDecl) Type() NodeType {
+	return NodeVariable
+}
+
+func (v *VariableDecl) ClassVariable() bool {
+	return strings.HasPrefix(v.Name, "@@")
+}
+
+// indexVariable records the instance or class variable assigned by node,
+// if any.
+func (i *Index) indexVariable(node parser.Node, file *sourceFile, sc refScope) {
+	var name string
+	var loc *parser.Location
+	switch n := node.(type) {
+	case *parser.InstanceVariableWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.InstanceVariableOrWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.InstanceVariableAndWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.InstanceVariableOperatorWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.InstanceVariableTargetNode:
+		name, loc = n.Name, n.Loc
+	case *parser.ClassVariableWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.ClassVariableOrWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.ClassVariableAndWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.ClassVariableOperatorWriteNode:
+		name, loc = n.Name, n.Nameloc
+	case *parser.ClassVariableTargetNode:
+		name, loc = n.Name, n.Loc
+	default:
+		return
+	}
+	if sc.namespace == "" || loc == nil {
+		return
+	}
+	start, err := file.location(int(loc.StartOffset))
+	if err != nil {
+		return
+	}
+	end, err := file.location(int(loc.EndOffset()))
+	if err != nil {
+		return
+	}
+	v := VariableDecl{Name: name, Owner: sc.namespace, Method: sc.method, r: &Range{Start: start, End: end}}
+	if !v.ClassVariable() {
+		v.Singleton = sc.singleton || sc.method == ""
+	}
+	i.VariableDecls = append(i.VariableDecls, v)
+}
+
+// Variables returns the assignments to the named instance or class
+// variable made in owner or its ancestors, nearest first. Only the
+// workspace is searched.
+func (i *Index) Variables(owner, name string, singleton bool) []*VariableDecl {
+	var res []*VariableDecl
+	for _, a := range i.Ancestors(owner) {
+		for _, v := range i.table().variables[a] {
+			if v.Name == name && (v.ClassVariable() || v.Singleton == singleton) {
+				res = append(res, v)
+			}
+		}
+	}
+	return res
+}
+
+// VariableNames returns the instance variables, or class variables if
+// the prefix starts with "@@", known to owner and its ancestors whose
+// names start with prefix.
+func (i *Index) VariableNames(owner, prefix string, singleton bool) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, a := range i.Ancestors(owner) {
+		for _, v := range i.table().variables[a] {
+			if seen[v.Name] || !strings.HasPrefix(v.Name, prefix) {
+				continue
+			}
+			if strings.HasPrefix(prefix, "@@") != v.ClassVariable() || !v.ClassVariable() && v.Singleton != singleton {
+				continue
+			}
+			seen[v.Name] = true
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
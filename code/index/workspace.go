@@ -0,0 +1,98 @@
+package index
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNotIndexed = errors.New("index not ready")
+
+// Workspace indexes a directory in the background and publishes every
+// finished index as an immutable snapshot, so queries see a consistent
+// view while the next generation is being built.
+type Workspace struct {
+	Root          string
+	AutoloadRoots []string
+	Include       []string
+	Exclude       []string
+	Builtins      *Index
+	// OnIndexed is called with every snapshot once it is published.
+	OnIndexed func(*Index)
+
+	current    atomic.Pointer[Index]
+	generation int
+	ready      chan struct{}
+	readyOnce  sync.Once
+	// mu serialises builds; pending is set while a build is queued behind
+	// the running one, so bursts of changes cause a single rebuild.
+	mu      sync.Mutex
+	pending atomic.Bool
+}
+
+func NewWorkspace(root string) *Workspace {
+	return &Workspace{
+		Root:  root,
+		ready: make(chan struct{}),
+	}
+}
+
+// Index builds a new generation of the index and publishes it. Calls made
+// while another build is waiting to start return immediately.
+func (w *Workspace) Index(logger *log.Logger) error {
+	if !w.pending.CompareAndSwap(false, true) {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending.Store(false)
+
+	i := New(w.Root)
+	i.AutoloadRoots = w.AutoloadRoots
+	i.Include = w.Include
+	i.Exclude = w.Exclude
+	i.Builtins = w.Builtins
+	if err := i.Start(logger); err != nil {
+		return err
+	}
+	w.publish(i)
+	return nil
+}
+
+// publish makes i the latest snapshot. Queries only read symbol tables, so
+// i, its Dependencies and its Builtins are finished first when they have
+// none yet; Builtins shared across generations are finished by the first.
+func (w *Workspace) publish(i *Index) {
+	for _, l := range []*Index{i, i.Dependencies, i.Builtins} {
+		if l != nil && l.symbols == nil {
+			l.finish()
+		}
+	}
+	w.generation++
+	i.Generation = w.generation
+	w.current.Store(i)
+	w.readyOnce.Do(func() {
+		close(w.ready)
+	})
+	if w.OnIndexed != nil {
+		w.OnIndexed(i)
+	}
+}
+
+// Snapshot returns the latest published index, waiting up to timeout for
+// the first one.
+func (w *Workspace) Snapshot(timeout time.Duration) (*Index, error) {
+	if i := w.current.Load(); i != nil {
+		return i, nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-w.ready:
+		return w.current.Load(), nil
+	case <-timer.C:
+		return nil, ErrNotIndexed
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	lsp "github.com/sourcegraph/go-lsp"
+)
+
+func (h *Handler) ExecuteCommand(params json.RawMessage) (any, error) {
+	var cmd lsp.ExecuteCommandParams
+	if err := json.Unmarshal(params, &cmd); err != nil {
+		return nil, err
+	}
+	switch cmd.Command {
+	case completionAccepted:
+		if len(cmd.Arguments) == 1 {
+			if label, ok := cmd.Arguments[0].(string); ok {
+				h.history.use(label)
+			}
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown command %s", cmd.Command)
+}
@@ -1,12 +1,11 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
-	"errors"
+	"strings"
 
-	sitter "github.com/smacker/go-tree-sitter"
 	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
 )
 
 func (h *Handler) TextCompletion(params json.RawMessage) (any, error) {
@@ -14,168 +13,400 @@ func (h *Handler) TextCompletion(params json.RawMessage) (any, error) {
 	if err := json.Unmarshal(params, &paramsData); err != nil {
 		return nil, err
 	}
-	var result []lsp.CompletionItem
-	for _, doc := range h.files {
-		// if filename == string(paramsData.TextDocument.URI) {
-		point := sitter.Point{
-			Row:    uint32(paramsData.Position.Line),
-			Column: uint32(paramsData.Position.Character),
-		}
-		selected := doc.tree.RootNode().NamedDescendantForPointRange(point, point)
-		if selected == nil {
-			return nil, errors.New("failed")
-		}
-		switch selected.Type() {
-		case "constant":
-			constant := selected.Content(doc.content)
-			h.logger.Printf("constant: %s\n", constant)
-		case "identifier":
-			ident := selected.Content(doc.content)
-			h.logger.Printf("ident: %s\n", ident)
-		default:
-			h.logger.Printf("unknown node type %s\n", selected.Type())
-		}
-		tree := doc.tree
-		allIdents, err := sitter.NewQuery([]byte(allIdentsQuery), h.language)
-		if err != nil {
-			return nil, err
-		}
-		queryCursor := sitter.NewQueryCursor()
-		queryCursor.Exec(allIdents, tree.RootNode())
-		for {
-			m, ok := queryCursor.NextMatch()
-			if !ok {
-				h.logger.Println("Query match not found")
-				break
-			}
-			h.logger.Println("match:", m)
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := h.document(paramsData.TextDocument.URI)
+	if !ok {
+		return CompletionList{Items: []CompletionItem{}}, nil
+	}
+	line := doc.lineBefore(paramsData.Position)
+	items, err := h.completions(idx, doc, paramsData.Position, line)
+	if err != nil {
+		return nil, err
+	}
+	word := typedWord(line)
+	items, incomplete := rankItems(idx, items, word, h.rankContext(idx, doc, paramsData, line), h.completionLimit)
+	return CompletionList{
+		IsIncomplete: incomplete,
+		Items:        completionItems(idx, items, paramsData.Position, word, h.snippets),
+	}, nil
+}
 
-			m = queryCursor.FilterPredicates(m, doc.content)
-			for _, c := range m.Captures {
-				h.logger.Println("content in the node:", c.Node.Content(doc.content))
+func (h *Handler) rankContext(idx *index.Index, doc *TextDocument, params lsp.CompletionParams, line string) rankContext {
+	ctx := rankContext{path: uriToPath(params.TextDocument.URI), history: &h.history}
+	if op, prefix, ok := callOperator(line); ok {
+		receiver := strings.TrimRight(line[:len(line)-len(prefix)-len(op)], " \t")
+		ctx.explicit = !strings.HasSuffix(receiver, "self")
+	}
+	point := doc.point(params.Position)
+	if node := doc.tree.RootNode().NamedDescendantForPointRange(point, point); node != nil {
+		if namespace, _ := enclosingScope(node, doc.content); namespace != "" {
+			ctx.ancestors = make(map[string]int)
+			for d, a := range idx.Ancestors(namespace) {
+				ctx.ancestors[a] = d
 			}
+		}
+	}
+	return ctx
+}
 
+func (h *Handler) completions(idx *index.Index, doc *TextDocument, pos lsp.Position, line string) ([]lsp.CompletionItem, error) {
+	// The items are filtered by the typed word when they are ranked.
+	if end, op, _, ok := receiverContext(line); ok {
+		if op == "::" {
+			point := doc.point(pos)
+			node := doc.tree.RootNode().NamedDescendantForPointRange(point, point)
+			return scopedItems(idx, constantBefore(line[:end]), lexicalNesting(node, doc.content), ""), nil
 		}
-		data, err := allIdentifiers(doc.content, h.language, h.parser, paramsData)
-		if err != nil {
-			return nil, err
+		types := doc.typeAt(idx, doc.offset(lsp.Position{Line: pos.Line})+end)
+		if class, _, ok := literalReceiver(line); ok && len(types) == 0 {
+			types = []index.Type{{Name: class}}
 		}
-		result = append(result, data...)
+		return methodItems(idx, callTypes(types, op), ""), nil
 	}
-	h.logger.Printf("All idents: %+v", result)
-	// find all possible things
-	return lsp.CompletionList{
-		IsIncomplete: false,
-		Items:        result,
-	}, nil
+	if op, prefix, ok := callOperator(line); ok {
+		// The receiver is spaced from the operator or on an earlier line,
+		// as in a chain continued on a new line.
+		end := doc.offset(pos) - len(prefix) - len(op)
+		for end > 0 && strings.IndexByte(" \t\r\n\\", doc.content[end-1]) >= 0 {
+			end--
+		}
+		return methodItems(idx, callTypes(doc.typeAt(idx, end), op), ""), nil
+	}
+	if prefix, ok := variablePrefix(line); ok {
+		point := doc.point(pos)
+		node := doc.tree.RootNode().NamedDescendantForPointRange(point, point)
+		namespace, singleton := enclosingScope(node, doc.content)
+		sigil := prefix[:strings.LastIndexByte(prefix, '@')+1]
+		return variableItems(idx, namespace, sigil, singleton), nil
+	}
+	result := identifierItems(idx, typedWord(line))
+	if doc.locals() != nil {
+		for _, l := range doc.locals().Visible(doc.offset(pos)) {
+			result = append(result, lsp.CompletionItem{
+				Label: l.Name,
+				Kind:  lsp.CIKVariable,
+			})
+		}
+	}
+	return result, nil
 }
 
-const allClassNamesQuery = `((class
-	name: [
-		(constant) @clsName
-    ]
-))`
+// identifierItems completes a bare identifier with the indexed constants
+// and methods whose names start with the first letter of word, in either
+// case, leaving the fuzzy match to ranking.
+func identifierItems(idx *index.Index, word string) []lsp.CompletionItem {
+	items := []lsp.CompletionItem{}
+	prefixes := []string{""}
+	if word != "" {
+		prefixes = []string{strings.ToUpper(word[:1])}
+		if lower := strings.ToLower(word[:1]); lower != prefixes[0] {
+			prefixes = append(prefixes, lower)
+		}
+	}
+	for _, prefix := range prefixes {
+		for _, name := range idx.ConstantNames(prefix) {
+			if nodes := idx.Constants(name); len(nodes) > 0 {
+				items = append(items, lsp.CompletionItem{Label: name, Kind: constantKind(nodes[0])})
+			}
+		}
+		for _, name := range idx.MethodNames(prefix) {
+			items = append(items, lsp.CompletionItem{Label: name, Kind: lsp.CIKMethod, Data: &completionData{Method: name}})
+		}
+	}
+	return items
+}
 
-const allMethodNamesQuery = `((method
-	name: (identifier) @ident
-))`
+func methodDetail(m *index.MethodDecl) string {
+	detail := m.FullName()
+	if len(m.Types) > 0 {
+		return detail + " " + m.Types[0].Text
+	}
+	return detail + "(" + strings.Join(m.Args, ", ") + ")"
+}
 
-const allIdentsQuery = `((identifier) @ident)`
+// receiverContext recognises a method call or constant lookup being typed
+// after `.`, `&.` or `::`, and returns where the receiver ends in line, the
+// operator and the partial name.
+func receiverContext(line string) (end int, op, prefix string, ok bool) {
+	start := len(line)
+	for start > 0 && isIdentByte(line[start-1]) {
+		start--
+	}
+	prefix = line[start:]
+	before := line[:start]
+	switch {
+	case strings.HasSuffix(before, "&."):
+		op = "&."
+	case strings.HasSuffix(before, "::"):
+		op = "::"
+	case strings.HasSuffix(before, ".") && !strings.HasSuffix(before, ".."):
+		op = "."
+	default:
+		return 0, "", "", false
+	}
+	end = start - len(op)
+	if end == 0 || line[end-1] == ' ' || line[end-1] == '\t' || op == "::" && !isIdentByte(line[end-1]) {
+		return 0, "", "", false
+	}
+	return end, op, prefix, true
+}
 
-func Map[T, V any](items []T, fn func(T) V) []V {
-	if items == nil {
-		return nil
+// callOperator recognises a method call being typed after `.` or `&.`,
+// wherever its receiver is, and returns the operator and partial name.
+func callOperator(line string) (op, prefix string, ok bool) {
+	start := len(line)
+	for start > 0 && isIdentByte(line[start-1]) {
+		start--
 	}
-	out := make([]V, 0, len(items))
-	for _, item := range items {
-		out = append(out, fn(item))
+	before := line[:start]
+	switch {
+	case strings.HasSuffix(before, "&."):
+		return "&.", line[start:], true
+	case strings.HasSuffix(before, ".") && !strings.HasSuffix(before, ".."):
+		return ".", line[start:], true
 	}
-	return out
+	return "", "", false
 }
 
-func allIdentifiers(data []byte, lang *sitter.Language, parser *sitter.Parser, params lsp.CompletionParams) ([]lsp.CompletionItem, error) {
-	classNames, err := executeQuery(allClassNamesQuery, data, lang, parser)
-	if err != nil {
-		return nil, err
+// callTypes narrows the types of a receiver to those a call after op is
+// made on: `&.` skips nil.
+func callTypes(types []index.Type, op string) []index.Type {
+	if op == "&." {
+		return filter(types, func(t index.Type) bool { return t != index.Type{Name: "NilClass"} })
 	}
-	methodNames, err := executeQuery(allMethodNamesQuery, data, lang, parser)
-	if err != nil {
-		return nil, err
+	return types
+}
+
+// constantBefore returns the constant path that ends s, such as
+// `Billing::Invoice` in `x = Billing::Invoice`.
+func constantBefore(s string) string {
+	start := len(s)
+	for start > 0 && (isIdentByte(s[start-1]) || s[start-1] == ':') {
+		start--
 	}
-	allIdents, err := executeQuery(allIdentsQuery, data, lang, parser)
-	if err != nil {
-		return nil, err
+	return s[start:]
+}
+
+// methodItems completes the methods receivers of the given types respond
+// to. Without a known type every indexed method name is offered.
+func methodItems(idx *index.Index, types []index.Type, prefix string) []lsp.CompletionItem {
+	items := []lsp.CompletionItem{}
+	if len(types) == 0 {
+		for _, name := range idx.MethodNames(prefix) {
+			items = append(items, lsp.CompletionItem{Label: name, Kind: lsp.CIKMethod, Data: &completionData{Method: name}})
+		}
+		return items
 	}
-	allIdentsMap := toSet(allIdents)
-	classes := Map(classNames, func(s string) lsp.CompletionItem {
-		delete(allIdentsMap, s)
-		return lsp.CompletionItem{
-			Label: s,
-			Kind:  lsp.CIKClass,
+	seen := make(map[string]bool)
+	for _, t := range types {
+		for _, m := range idx.MethodsOn(t) {
+			if seen[m.Name] || !strings.HasPrefix(m.Name, prefix) {
+				continue
+			}
+			seen[m.Name] = true
+			items = append(items, methodItem(m))
 		}
-	})
-	methods := Map(methodNames, func(s string) lsp.CompletionItem {
-		delete(allIdentsMap, s)
-		return lsp.CompletionItem{
-			Label: s,
-			Kind:  lsp.CIKMethod,
+	}
+	return items
+}
+
+func methodItem(m *index.MethodDecl) lsp.CompletionItem {
+	return lsp.CompletionItem{
+		Label: m.Name,
+		Kind:  lsp.CIKMethod,
+		Data:  &completionData{Method: m.Name, Owner: m.Owner, Singleton: m.Singleton},
+	}
+}
+
+// scopedItems completes `Foo::` with the constants nested in Foo and its
+// class methods.
+func scopedItems(idx *index.Index, path string, nesting []string, prefix string) []lsp.CompletionItem {
+	items := []lsp.CompletionItem{}
+	full, _, ok := idx.ResolveConstant(path, nesting)
+	if !ok {
+		return items
+	}
+	seen := make(map[string]bool)
+	for _, n := range idx.ConstantsIn(full) {
+		name := constantName(n)
+		if seen[name] || !strings.HasPrefix(name, prefix) {
+			continue
 		}
-	})
-	allIdents = toSlice(allIdentsMap)
-	idents := Map(allIdents, func(s string) lsp.CompletionItem {
-		return lsp.CompletionItem{
-			Label: s,
-			Kind:  lsp.CIKVariable,
+		seen[name] = true
+		items = append(items, lsp.CompletionItem{
+			Label: name,
+			Kind:  constantKind(n),
+			Data:  &completionData{Constant: full + "::" + name},
+		})
+	}
+	for _, m := range idx.MethodsOn(index.Type{Name: full, Singleton: true}) {
+		if !seen[m.Name] && strings.HasPrefix(m.Name, prefix) {
+			seen[m.Name] = true
+			items = append(items, methodItem(m))
 		}
-	})
-	return join(classes, methods, idents), nil
+	}
+	return items
 }
 
-func toSet[T comparable](data []T) map[T]struct{} {
-	m := make(map[T]struct{})
-	for _, e := range data {
-		m[e] = struct{}{}
+func constantName(n index.Node) string {
+	switch d := n.(type) {
+	case *index.ModuleDecl:
+		return d.Name
+	case *index.ClassDecl:
+		return d.Name
+	case *index.ConstantDecl:
+		return d.Name
 	}
-	return m
+	return ""
 }
 
-func join[T any](a []T, rest ...[]T) []T {
-	for _, d := range rest {
-		a = append(a, d...)
+func constantKind(n index.Node) lsp.CompletionItemKind {
+	switch n.Type() {
+	case index.NodeClass:
+		return lsp.CIKClass
+	case index.NodeModule:
+		return lsp.CIKModule
 	}
-	return a
+	return lsp.CIKConstant
 }
 
-func toSlice[T comparable, M any](data map[T]M) []T {
-	var slice []T
-	for e := range data {
-		slice = append(slice, e)
+// variablePrefix recognises an instance or class variable being typed and
+// returns it, sigil included.
+func variablePrefix(line string) (string, bool) {
+	end := len(line)
+	for end > 0 && isIdentByte(line[end-1]) {
+		end--
 	}
-	return slice
+	start := end
+	for start > 0 && end-start < 2 && line[start-1] == '@' {
+		start--
+	}
+	if start == end || start > 0 && isIdentByte(line[start-1]) {
+		return "", false
+	}
+	return line[start:], true
 }
 
-func executeQuery(query string, src []byte, lang *sitter.Language, parser *sitter.Parser) ([]string, error) {
-	tree, err := parser.ParseCtx(context.Background(), nil, src)
-	if err != nil {
-		return nil, err
+func variableItems(idx *index.Index, namespace, prefix string, singleton bool) []lsp.CompletionItem {
+	items := []lsp.CompletionItem{}
+	if namespace == "" {
+		return items
 	}
-	q, err := sitter.NewQuery([]byte(query), lang)
-	if err != nil {
-		return nil, err
+	for _, name := range idx.VariableNames(namespace, prefix, singleton) {
+		items = append(items, lsp.CompletionItem{
+			Label:  name,
+			Kind:   lsp.CIKField,
+			Detail: namespace,
+		})
 	}
-	queryCursor := sitter.NewQueryCursor()
-	queryCursor.Exec(q, tree.RootNode())
-	var idents []string
-	for {
-		m, ok := queryCursor.NextMatch()
-		if !ok {
-			break
+	return items
+}
+
+func (d *TextDocument) lineBefore(pos lsp.Position) string {
+	return string(d.content[d.offset(lsp.Position{Line: pos.Line}):d.offset(pos)])
+}
+
+// literalReceiver recognises a method call being typed on a literal, such
+// as `"abc".up` or `[1, 2].`, and returns the class of the literal and the
+// partial method name.
+func literalReceiver(line string) (class, prefix string, ok bool) {
+	end := len(line)
+	for end > 0 && isIdentByte(line[end-1]) {
+		end--
+	}
+	prefix = line[end:]
+	if end == 0 || line[end-1] != '.' {
+		return "", "", false
+	}
+	recv := line[:end-1]
+	if recv == "" || strings.HasSuffix(recv, ".") {
+		return "", "", false
+	}
+	switch last := recv[len(recv)-1]; {
+	case last == '"' || last == '\'':
+		return "String", prefix, true
+	case last == ']':
+		if open := matchingOpen(recv, '[', ']'); open >= 0 && (open == 0 || !isIdentByte(recv[open-1])) {
+			return "Array", prefix, true
+		}
+	case last == '}':
+		if open := matchingOpen(recv, '{', '}'); open >= 0 {
+			before := strings.TrimRight(recv[:open], " ")
+			if before == "" || strings.ContainsAny(before[len(before)-1:], "=(,[") {
+				return "Hash", prefix, true
+			}
+		}
+	case last == '/':
+		if strings.Count(recv, "/") >= 2 {
+			return "Regexp", prefix, true
 		}
+	case isIdentByte(last):
+		start := len(recv)
+		for start > 0 && (isIdentByte(recv[start-1]) || recv[start-1] == '.') {
+			start--
+		}
+		word := recv[start:]
+		if start > 0 && recv[start-1] == ':' && (start == 1 || recv[start-2] != ':') {
+			return "Symbol", prefix, true
+		}
+		switch {
+		case word == "nil":
+			return "NilClass", prefix, true
+		case word == "true":
+			return "TrueClass", prefix, true
+		case word == "false":
+			return "FalseClass", prefix, true
+		case strings.Trim(word, "0123456789_") == "":
+			return "Integer", prefix, true
+		case strings.Trim(word, "0123456789_.") == "" && strings.Count(word, ".") == 1 && word[0] != '.':
+			return "Float", prefix, true
+		}
+	}
+	return "", "", false
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '?' || b == '!' || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z') || ('0' <= b && b <= '9')
+}
 
-		m = queryCursor.FilterPredicates(m, src)
-		for _, c := range m.Captures {
-			idents = append(idents, c.Node.Content(src))
+// matchingOpen returns the position of the bracket opening the one that
+// ends s.
+func matchingOpen(s string, open, close byte) int {
+	depth := 0
+	for k := len(s) - 1; k >= 0; k-- {
+		switch s[k] {
+		case close:
+			depth++
+		case open:
+			depth--
+			if depth == 0 {
+				return k
+			}
 		}
 	}
-	return idents, nil
+	return -1
+}
+
+func Map[T, V any](items []T, fn func(T) V) []V {
+	if items == nil {
+		return nil
+	}
+	out := make([]V, 0, len(items))
+	for _, item := range items {
+		out = append(out, fn(item))
+	}
+	return out
+}
+
+func filter[T any](items []T, keep func(T) bool) []T {
+	var out []T
+	for _, item := range items {
+		if keep(item) {
+			out = append(out, item)
+		}
+	}
+	return out
 }
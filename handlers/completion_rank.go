@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+// defaultCompletionLimit caps completion lists when the client does not
+// configure completionLimit.
+const defaultCompletionLimit = 100
+
+// completionHistory remembers which completion items the user accepted,
+// as reported by their completionAccepted command.
+type completionHistory struct {
+	mu   sync.Mutex
+	seq  int
+	last map[string]int
+}
+
+func (c *completionHistory) use(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil {
+		c.last = make(map[string]int)
+	}
+	c.seq++
+	c.last[label] = c.seq
+}
+
+// recency is 15 for the item accepted last, falling to 0 for items not
+// accepted in the last 15.
+func (c *completionHistory) recency(label string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, ok := c.last[label]
+	if !ok {
+		return 0
+	}
+	return max(0, 15-(c.seq-last))
+}
+
+// rankContext is where completion was requested, for scoring locality.
+type rankContext struct {
+	path string
+	// ancestors holds the distance of each ancestor of the class around
+	// the cursor, 0 for the class itself.
+	ancestors map[string]int
+	history   *completionHistory
+	// explicit is set after a receiver other than self, where private
+	// methods cannot be called.
+	explicit bool
+}
+
+// rankItems keeps the items fuzzily matching word, best first, and at most
+// limit of them. It reports whether any were cut.
+func rankItems(idx *index.Index, items []lsp.CompletionItem, word string, ctx rankContext, limit int) ([]lsp.CompletionItem, bool) {
+	type scored struct {
+		item  lsp.CompletionItem
+		score int
+	}
+	var matches []scored
+	for _, item := range items {
+		score, ok := fuzzyScore(word, item.Label)
+		if !ok {
+			continue
+		}
+		bonus, visible := ctx.locality(idx, item)
+		if !visible {
+			continue
+		}
+		matches = append(matches, scored{item, score + bonus})
+	}
+	sort.SliceStable(matches, func(a, b int) bool {
+		ma, mb := matches[a], matches[b]
+		if ma.score != mb.score {
+			return ma.score > mb.score
+		}
+		if len(ma.item.Label) != len(mb.item.Label) {
+			return len(ma.item.Label) < len(mb.item.Label)
+		}
+		return ma.item.Label < mb.item.Label
+	})
+	incomplete := len(matches) > limit
+	if incomplete {
+		matches = matches[:limit]
+	}
+	res := make([]lsp.CompletionItem, len(matches))
+	// Pad to the same width so clients sorting as text keep the order.
+	width := max(4, len(strconv.Itoa(len(res))))
+	for k, m := range matches {
+		res[k] = m.item
+		res[k].SortText = fmt.Sprintf("%0*d", width, k)
+		res[k].FilterText = m.item.Label
+	}
+	return res, incomplete
+}
+
+// locality scores how close the item is to the cursor: visible locals
+// first, then the members of the class at the cursor and its nearest
+// ancestors, declarations in the same file and recently used items.
+// Protected and private methods score lower, and private ones are not
+// visible after an explicit receiver.
+func (c rankContext) locality(idx *index.Index, item lsp.CompletionItem) (int, bool) {
+	score := 0
+	if c.history != nil {
+		score += c.history.recency(item.Label)
+	}
+	if item.Kind == lsp.CIKVariable {
+		return score + 25, true
+	}
+	data := itemData(item)
+	if data == nil {
+		return score, true
+	}
+	var decl index.Node
+	switch {
+	case data.Method != "":
+		m := resolveMethod(idx, data)
+		if m == nil {
+			return score, true
+		}
+		switch visibility(idx, data, m) {
+		case index.Protected:
+			score -= 5
+		case index.Private:
+			if c.explicit {
+				return 0, false
+			}
+			score -= 10
+		}
+		if d, ok := c.ancestors[m.Owner]; ok && data.Owner != "" {
+			score += max(2, 20-3*d)
+		}
+		decl = m
+	case data.Constant != "":
+		if _, nodes, ok := idx.ResolveConstant(data.Constant, nil); ok {
+			decl = nodes[0]
+		}
+	}
+	if decl != nil && decl.Range() != nil && decl.Range().Start.FileURI == c.path {
+		score += 10
+	}
+	return score, true
+}
+
+// visibility returns the visibility of the method an item completes. An
+// item without an owner stands for every method of its name, so it is as
+// visible as the most visible of them.
+func visibility(idx *index.Index, data *completionData, m *index.MethodDecl) index.Visibility {
+	if data.Owner != "" {
+		return m.Visibility
+	}
+	v := m.Visibility
+	for _, other := range idx.Methods(data.Method) {
+		v = min(v, other.Visibility)
+	}
+	return v
+}
+
+// fuzzyScore matches pattern against name as a case-insensitive
+// subsequence, or reports false. Prefix matches, matches at the start of
+// words, consecutive matches and matching case score higher; gaps and long
+// names lower.
+func fuzzyScore(pattern, name string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	score, k, prev := 0, 0, -1
+	for j := 0; j < len(name) && k < len(pattern); j++ {
+		if lower(name[j]) != lower(pattern[k]) {
+			continue
+		}
+		score++
+		switch {
+		case j == 0:
+			score += 8
+		case j == prev+1:
+			score += 4
+		case wordStart(name, j):
+			score += 6
+		default:
+			score -= min(j-prev-1, 3)
+		}
+		if name[j] == pattern[k] {
+			score++
+		}
+		prev = j
+		k++
+	}
+	if k < len(pattern) {
+		return 0, false
+	}
+	switch {
+	case strings.HasPrefix(name, pattern):
+		score += 10
+	case strings.HasPrefix(strings.ToLower(name), strings.ToLower(pattern)):
+		score += 6
+	}
+	return score - (len(name)-len(pattern))/4, true
+}
+
+func lower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// wordStart reports whether name[j] starts a word, after an underscore,
+// sigil or colon or at a change to upper case.
+func wordStart(name string, j int) bool {
+	switch p := name[j-1]; {
+	case p == '_' || p == '@' || p == ':':
+		return true
+	case 'a' <= p && p <= 'z':
+		return 'A' <= name[j] && name[j] <= 'Z'
+	}
+	return false
+}
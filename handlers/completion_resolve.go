@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+// CompletionItem adds markdown documentation and typed resolve data to
+// go-lsp's completion item.
+type CompletionItem struct {
+	lsp.CompletionItem
+	Documentation *MarkupContent  `json:"documentation,omitempty"`
+	Data          *completionData `json:"data,omitempty"`
+	// Command runs once the item is accepted.
+	Command *lsp.Command `json:"command,omitempty"`
+}
+
+// completionAccepted is the command completion items run when accepted,
+// which feeds the recency of completion ranking.
+const completionAccepted = "ruby.completionAccepted"
+
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+// completionData identifies the declaration an item completes, so that
+// completionItem/resolve can find it again. Methods without an Owner are
+// looked up by name.
+type completionData struct {
+	Method    string `json:"method,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	Singleton bool   `json:"singleton,omitempty"`
+	Constant  string `json:"constant,omitempty"`
+}
+
+// completionItems prepares items for the response: each replaces the word
+// typed before pos, with a snippet when snippets is set and the item is a
+// method taking arguments, and carries what resolve needs to look it up.
+// Resolve may only fill in detail and documentation, so the edit is
+// complete here.
+func completionItems(idx *index.Index, items []lsp.CompletionItem, pos lsp.Position, word string, snippets bool) []CompletionItem {
+	res := make([]CompletionItem, 0, len(items))
+	start := lsp.Position{Line: pos.Line, Character: pos.Character - len(word)}
+	for _, item := range items {
+		c := CompletionItem{CompletionItem: item, Data: itemData(item)}
+		c.CompletionItem.Data = nil
+		c.TextEdit = &lsp.TextEdit{Range: lsp.Range{Start: start, End: pos}, NewText: item.Label}
+		c.Command = &lsp.Command{Command: completionAccepted, Arguments: []any{item.Label}}
+		if snippets && c.Data != nil && c.Data.Method != "" {
+			if m := resolveMethod(idx, c.Data); m != nil {
+				if snippet := methodSnippet(m); snippet != "" {
+					c.TextEdit.NewText = snippet
+					c.InsertTextFormat = lsp.ITFSnippet
+				}
+			}
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// itemData returns the resolve data of an item, which items found by name
+// only get from their label and kind.
+func itemData(item lsp.CompletionItem) *completionData {
+	if data, ok := item.Data.(*completionData); ok {
+		return data
+	}
+	switch item.Kind {
+	case lsp.CIKMethod:
+		return &completionData{Method: item.Label}
+	case lsp.CIKClass, lsp.CIKModule, lsp.CIKConstant:
+		return &completionData{Constant: item.Label}
+	}
+	return nil
+}
+
+// typedWord returns the identifier, or instance or class variable, that
+// ends line.
+func typedWord(line string) string {
+	if prefix, ok := variablePrefix(line); ok {
+		return prefix
+	}
+	start := len(line)
+	for start > 0 && isIdentByte(line[start-1]) {
+		start--
+	}
+	return line[start:]
+}
+
+func (h *Handler) ResolveCompletion(params json.RawMessage) (any, error) {
+	var item CompletionItem
+	if err := json.Unmarshal(params, &item); err != nil {
+		return nil, err
+	}
+	if item.Data == nil {
+		return item, nil
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case item.Data.Method != "":
+		if m := resolveMethod(idx, item.Data); m != nil {
+			item.Detail = methodDetail(m)
+			item.Documentation = markdown(m.Doc)
+		}
+	case item.Data.Constant != "":
+		nodes := idx.Constants(item.Data.Constant)
+		if _, resolved, ok := idx.ResolveConstant(item.Data.Constant, nil); ok {
+			nodes = resolved
+		}
+		if len(nodes) > 0 {
+			item.Detail = constantDetail(nodes[0])
+			item.Documentation = markdown(constantDoc(nodes[0]))
+		}
+	}
+	return item, nil
+}
+
+func resolveMethod(idx *index.Index, data *completionData) *index.MethodDecl {
+	if data.Owner == "" {
+		if methods := idx.Methods(data.Method); len(methods) > 0 {
+			return methods[0]
+		}
+		return nil
+	}
+	for _, m := range idx.MethodsOf(data.Owner, data.Singleton) {
+		if m.Name == data.Method {
+			return m
+		}
+	}
+	return nil
+}
+
+func markdown(doc *index.Doc) *MarkupContent {
+	md := doc.Markdown()
+	if md == "" {
+		return nil
+	}
+	return &MarkupContent{Kind: "markdown", Value: md}
+}
+
+func constantDetail(n index.Node) string {
+	switch d := n.(type) {
+	case *index.ModuleDecl:
+		return "module " + d.FullName()
+	case *index.ClassDecl:
+		if d.Superclass != "" {
+			return "class " + d.FullName() + " < " + d.Superclass
+		}
+		return "class " + d.FullName()
+	case *index.ConstantDecl:
+		return d.FullName()
+	}
+	return ""
+}
+
+func constantDoc(n index.Node) *index.Doc {
+	switch d := n.(type) {
+	case *index.ModuleDecl:
+		return d.Doc
+	case *index.ClassDecl:
+		return d.Doc
+	case *index.ConstantDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+// methodSnippet returns a snippet calling m with a placeholder for each
+// required argument, or "" when it takes none.
+func methodSnippet(m *index.MethodDecl) string {
+	if m.Name == "" || strings.HasSuffix(m.Name, "=") || !isIdentByte(m.Name[0]) {
+		return ""
+	}
+	var args []string
+	for k, p := range requiredParams(m) {
+		if name, ok := strings.CutSuffix(p, ":"); ok {
+			args = append(args, fmt.Sprintf("%s: ${%d:%s}", name, k+1, name))
+		} else {
+			args = append(args, fmt.Sprintf("${%d:%s}", k+1, p))
+		}
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return m.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// requiredParams returns the positional and keyword parameters a call to
+// m must pass, keywords with a trailing colon. Typed overloads and def
+// signatures tell required parameters apart; otherwise every argument is
+// taken to be required.
+func requiredParams(m *index.MethodDecl) []string {
+	var res []string
+	if len(m.Types) > 0 {
+		for _, p := range m.Types[0].Params {
+			switch p.Kind {
+			case index.ParamRequired:
+				res = append(res, p.Name)
+			case index.ParamKeyword:
+				res = append(res, p.Name+":")
+			}
+		}
+		return res
+	}
+	sig, ok := strings.CutPrefix(m.Signature, "def ")
+	if !ok {
+		return m.Args
+	}
+	open := strings.IndexByte(sig, '(')
+	if open < 0 {
+		return nil
+	}
+	depth, start := 0, open+1
+	for k := open; k < len(sig); k++ {
+		switch sig[k] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		}
+		if depth == 1 && sig[k] == ',' || depth == 0 {
+			if p := strings.TrimSpace(sig[start:k]); p != "" && !strings.ContainsAny(p[:1], "*&") {
+				if name, ok := strings.CutSuffix(p, ":"); ok {
+					res = append(res, name+":")
+				} else if !strings.ContainsAny(p, "=:") {
+					res = append(res, p)
+				}
+			}
+			start = k + 1
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	return res
+}
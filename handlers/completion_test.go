@@ -2,44 +2,47 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	sitter "github.com/smacker/go-tree-sitter"
 	"github.com/smacker/go-tree-sitter/ruby"
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
 )
 
 func TestCompletion(t *testing.T) {
-	language := ruby.GetLanguage()
-	parser := sitter.NewParser()
-	parser.SetLanguage(language)
-	source := `
+	source := `class Invoice
+  def total
+    items.sum(&:price)
+  end
+end
 `
 	tree, err := sitter.ParseCtx(context.Background(), []byte(source), ruby.GetLanguage())
 	if err != nil {
 		t.Fatal(err)
 	}
-	selectedNode := tree.NamedDescendantForPointRange(sitter.Point{
-		Row:    648,
-		Column: 9,
-	}, sitter.Point{
-		Row:    648,
-		Column: 9,
-	})
-	// var visit func(n *sitter.Node, name string, depth int)
-	// visit = func(n *sitter.Node, name string, depth int) {
-	// }
-	var parent, currentNode *sitter.Node
-	currentNode = selectedNode
-	for {
-		parent = currentNode.Parent()
+	point := sitter.Point{Row: 2, Column: 9}
+	selectedNode := tree.NamedDescendantForPointRange(point, point)
+	var parent *sitter.Node
+	for parent = selectedNode.Parent(); parent != nil; parent = parent.Parent() {
 		if parent.Type() == "method" {
 			break
 		}
-		currentNode = parent
 	}
-	data := parent.Content([]byte(source))
-	_ = data
+	if parent == nil {
+		t.Fatalf("no method around %s", selectedNode.Type())
+	}
+	printNode(t, parent, 0, "", []byte(source))
+	if name := parent.ChildByFieldName("name"); name == nil || name.Content([]byte(source)) != "total" {
+		t.Errorf("unexpected enclosing method: %s", parent.Content([]byte(source)))
+	}
 }
 
 func printNode(t *testing.T, n *sitter.Node, depth int, name string, source []byte) {
@@ -49,3 +52,330 @@ func printNode(t *testing.T, n *sitter.Node, depth int, name string, source []by
 	}
 	t.Logf("%s%s%s [%d-%d] %s\n", strings.Repeat("    ", depth), prefix, n.Type(), n.StartByte(), n.EndByte(), source[n.StartByte():n.EndByte()])
 }
+
+func TestLiteralReceiver(t *testing.T) {
+	tests := []struct {
+		line, class, prefix string
+	}{
+		{`  name = "abc".gs`, "String", "gs"},
+		{`'x'.`, "String", ""},
+		{`[1, [2]].each_sl`, "Array", "each_sl"},
+		{`h = { a: 1 }.di`, "Hash", "di"},
+		{`42.ti`, "Integer", "ti"},
+		{`1.5.ro`, "Float", "ro"},
+		{`:name.to`, "Symbol", "to"},
+		{`nil.to_`, "NilClass", "to_"},
+		{`items[0].up`, "", ""},
+		{`list.each { |x| x }.fo`, "", ""},
+		{`Foo::BAR.siz`, "", ""},
+	}
+	for _, tt := range tests {
+		class, prefix, _ := literalReceiver(tt.line)
+		if class != tt.class || prefix != tt.prefix {
+			t.Errorf("literalReceiver(%q) = %q, %q; want %q, %q", tt.line, class, prefix, tt.class, tt.prefix)
+		}
+	}
+}
+
+func TestReceiverContext(t *testing.T) {
+	tests := []struct {
+		line     string
+		receiver string
+		op       string
+		prefix   string
+		ok       bool
+	}{
+		{`    invoice.to`, "    invoice", ".", "to", true},
+		{`  user&.na`, "  user", "&.", "na", true},
+		{`  Billing::Inv`, "  Billing", "::", "Inv", true},
+		{`  x = Foo.new.`, "  x = Foo.new", ".", "", true},
+		{`  ::Top`, "", "", "", false},
+		{`  (1..`, "", "", "", false},
+		{`  name`, "", "", "", false},
+	}
+	for _, tt := range tests {
+		end, op, prefix, ok := receiverContext(tt.line)
+		if ok != tt.ok || ok && (tt.line[:end] != tt.receiver || op != tt.op || prefix != tt.prefix) {
+			t.Errorf("receiverContext(%q) = %d, %q, %q, %t", tt.line, end, op, prefix, ok)
+		}
+	}
+	calls := []struct {
+		line, op, prefix string
+		ok               bool
+	}{
+		{`    .where`, ".", "where", true},
+		{`  user &.na`, "&.", "na", true},
+		{`  (1..`, "", "", false},
+		{`  Billing::Inv`, "", "", false},
+	}
+	for _, tt := range calls {
+		op, prefix, ok := callOperator(tt.line)
+		if op != tt.op || prefix != tt.prefix || ok != tt.ok {
+			t.Errorf("callOperator(%q) = %q, %q, %t", tt.line, op, prefix, ok)
+		}
+	}
+	if got := constantBefore("  x = ::Billing::Invoice"); got != "::Billing::Invoice" {
+		t.Errorf("constantBefore = %q", got)
+	}
+}
+
+func TestVariablePrefix(t *testing.T) {
+	tests := []struct {
+		line, prefix string
+		ok           bool
+	}{
+		{`    @`, "@", true},
+		{`    @cur`, "@cur", true},
+		{`  x = @@co`, "@@co", true},
+		{`  "user@exa`, "", false},
+		{`  current_user`, "", false},
+	}
+	for _, tt := range tests {
+		prefix, ok := variablePrefix(tt.line)
+		if prefix != tt.prefix || ok != tt.ok {
+			t.Errorf("variablePrefix(%q) = %q, %t; want %q, %t", tt.line, prefix, ok, tt.prefix, tt.ok)
+		}
+	}
+}
+
+func TestEnclosingScope(t *testing.T) {
+	source := []byte(`module Admin
+  class Users::Report
+    @cache = {}
+
+    def self.build
+      @built = true
+    end
+
+    def rows
+      @rows
+    end
+  end
+end
+`)
+	tree, err := sitter.ParseCtx(context.Background(), source, ruby.GetLanguage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		row, column uint32
+		singleton   bool
+	}{
+		{2, 5, true},
+		{5, 8, true},
+		{9, 8, false},
+	}
+	for _, tt := range tests {
+		point := sitter.Point{Row: tt.row, Column: tt.column}
+		node := tree.NamedDescendantForPointRange(point, point)
+		namespace, singleton := enclosingScope(node, source)
+		if namespace != "Admin::Users::Report" || singleton != tt.singleton {
+			t.Errorf("enclosingScope at %d:%d = %s, %t", tt.row, tt.column, namespace, singleton)
+		}
+	}
+	source = []byte("module Admin\n  class ::AuditLog\n    def record\n      @at\n    end\n  end\nend\n")
+	tree, err = sitter.ParseCtx(context.Background(), source, ruby.GetLanguage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := sitter.Point{Row: 3, Column: 7}
+	if namespace, _ := enclosingScope(tree.NamedDescendantForPointRange(point, point), source); namespace != "AuditLog" {
+		t.Errorf("enclosingScope in ::AuditLog = %s", namespace)
+	}
+}
+
+func TestMethodSnippet(t *testing.T) {
+	tests := []struct {
+		method index.MethodDecl
+		want   string
+	}{
+		{index.MethodDecl{Name: "charge", Signature: "def charge(amount, currency = 'USD', *rest, account:, memo: nil, **opts, &blk)"}, "charge(${1:amount}, account: ${2:account})"},
+		{index.MethodDecl{Name: "reset", Signature: "def reset"}, ""},
+		{index.MethodDecl{Name: "merge", Signature: "def merge(other = {}, strict: [1, 2])"}, ""},
+		{index.MethodDecl{Name: "name=", Signature: "def name=(value)"}, ""},
+		{index.MethodDecl{Signature: "def (value)", Args: []string{"value"}}, ""},
+		{index.MethodDecl{Name: "new", Signature: "Struct.new(:x, :y)", Args: []string{"x", "y"}}, "new(${1:x}, ${2:y})"},
+		{index.MethodDecl{Name: "find", Types: []index.MethodType{{Params: []index.TypedParam{
+			{Name: "id", Kind: index.ParamRequired},
+			{Name: "scope", Kind: index.ParamOptional},
+			{Name: "lock", Kind: index.ParamKeyword},
+		}}}}, "find(${1:id}, lock: ${2:lock})"},
+	}
+	for _, tt := range tests {
+		if got := methodSnippet(&tt.method); got != tt.want {
+			t.Errorf("methodSnippet(%s) = %q, want %q", tt.method.Name, got, tt.want)
+		}
+	}
+}
+
+func TestCompletionItems(t *testing.T) {
+	line := "    invoice.to"
+	pos := lsp.Position{Line: 3, Character: len(line)}
+	items := completionItems(nil, []lsp.CompletionItem{
+		{Label: "total", Kind: lsp.CIKMethod},
+		{Label: "Invoice", Kind: lsp.CIKClass},
+		{Label: "@total", Kind: lsp.CIKField},
+	}, pos, typedWord(line), false)
+	for _, item := range items {
+		edit := item.TextEdit
+		if edit == nil || edit.Range.Start.Character != len(line)-2 || edit.Range.End != pos || edit.NewText != item.Label {
+			t.Errorf("unexpected edit for %s: %+v", item.Label, edit)
+		}
+	}
+	if items[0].Data == nil || items[0].Data.Method != "total" || items[1].Data == nil || items[1].Data.Constant != "Invoice" || items[2].Data != nil {
+		t.Errorf("unexpected resolve data: %+v %+v %+v", items[0].Data, items[1].Data, items[2].Data)
+	}
+	if got := typedWord("  x = @@co"); got != "@@co" {
+		t.Errorf("typedWord = %q", got)
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	better := [][3]string{
+		// pattern, preferred, other
+		{"fb", "foo_bar", "fabric"},
+		{"Inv", "Invoice", "invoice"},
+		{"to", "to_s", "photo"},
+		{"fN", "firstName", "fontName_x"},
+	}
+	for _, tt := range better {
+		a, okA := fuzzyScore(tt[0], tt[1])
+		b, okB := fuzzyScore(tt[0], tt[2])
+		if !okA || !okB || a <= b {
+			t.Errorf("fuzzyScore(%q): %s = %d, %s = %d", tt[0], tt[1], a, tt[2], b)
+		}
+	}
+	if _, ok := fuzzyScore("gs", "to_s"); ok {
+		t.Error("fuzzyScore matched a name missing a pattern character")
+	}
+}
+
+func TestRankItems(t *testing.T) {
+	items := []lsp.CompletionItem{
+		{Label: "@total", Kind: lsp.CIKField},
+		{Label: "@name", Kind: lsp.CIKField},
+		{Label: "@tax", Kind: lsp.CIKField},
+		{Label: "tally", Kind: lsp.CIKVariable},
+	}
+	ranked, incomplete := rankItems(nil, items, "@t", rankContext{}, 2)
+	if incomplete || len(ranked) != 2 || ranked[0].Label != "@tax" || ranked[1].Label != "@total" {
+		t.Fatalf("rankItems = %+v, %t", ranked, incomplete)
+	}
+	if ranked[0].SortText != "0000" || ranked[1].SortText != "0001" || ranked[1].FilterText != "@total" {
+		t.Errorf("unexpected sort or filter text: %+v", ranked)
+	}
+	if ranked, incomplete = rankItems(nil, items, "@t", rankContext{}, 1); !incomplete || len(ranked) != 1 {
+		t.Errorf("rankItems with limit 1 = %+v, %t", ranked, incomplete)
+	}
+	ranked, incomplete = rankItems(nil, items, "ta", rankContext{}, 10)
+	if incomplete || len(ranked) != 3 || ranked[0].Label != "tally" {
+		t.Errorf("visible locals should rank first: %+v", ranked)
+	}
+	many := make([]lsp.CompletionItem, 10001)
+	for k := range many {
+		many[k] = lsp.CompletionItem{Label: fmt.Sprintf("item%d", k), Kind: lsp.CIKField}
+	}
+	ranked, _ = rankItems(nil, many, "", rankContext{}, len(many))
+	if ranked[9999].SortText >= ranked[10000].SortText {
+		t.Errorf("sort text out of order: %s, %s", ranked[9999].SortText, ranked[10000].SortText)
+	}
+}
+
+func TestRankVisibility(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ledger.rb": "class Ledger\n  private\n\n  def audit\n  end\n\n  def seal\n  end\nend\n",
+		"report.rb": "class Report\n  def audit\n  end\nend\n",
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := index.New(dir)
+	if err := idx.Start(log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	items := []lsp.CompletionItem{
+		{Label: "audit", Kind: lsp.CIKMethod, Data: &completionData{Method: "audit"}},
+		{Label: "seal", Kind: lsp.CIKMethod, Data: &completionData{Method: "seal"}},
+	}
+	ranked, _ := rankItems(idx, items, "", rankContext{explicit: true}, 10)
+	if len(ranked) != 1 || ranked[0].Label != "audit" {
+		t.Errorf("only the public audit should be visible after a receiver: %+v", ranked)
+	}
+}
+
+func TestCompletionSnippets(t *testing.T) {
+	idx := index.New("../code/index/testdata/types")
+	if err := idx.Start(log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	pos := lsp.Position{Line: 0, Character: 10}
+	find := lsp.CompletionItem{Label: "find", Kind: lsp.CIKMethod, Data: &completionData{Method: "find", Owner: "Billing::Invoice", Singleton: true}}
+	items := completionItems(idx, []lsp.CompletionItem{find}, pos, "fi", true)
+	if got := items[0]; got.TextEdit.NewText != "find(${1:id})" || got.InsertTextFormat != lsp.ITFSnippet {
+		t.Errorf("unexpected snippet edit: %+v", got)
+	}
+	items = completionItems(idx, []lsp.CompletionItem{find}, pos, "fi", false)
+	if got := items[0]; got.TextEdit.NewText != "find" || got.InsertTextFormat != 0 {
+		t.Errorf("snippet sent to a client without snippet support: %+v", got)
+	}
+}
+
+func TestIdentifierItems(t *testing.T) {
+	idx := index.New("../code/index/testdata/types")
+	if err := idx.Start(log.New(io.Discard, "", 0)); err != nil {
+		t.Fatal(err)
+	}
+	kinds := make(map[string]lsp.CompletionItemKind)
+	for _, item := range identifierItems(idx, "inv") {
+		kinds[item.Label] = item.Kind
+	}
+	if kinds["Invoice"] != lsp.CIKClass || kinds["Billing"] != 0 || kinds["total"] != 0 {
+		t.Errorf("unexpected identifier items: %v", kinds)
+	}
+	kinds = make(map[string]lsp.CompletionItemKind)
+	for _, item := range identifierItems(idx, "Ba") {
+		kinds[item.Label] = item.Kind
+	}
+	if kinds["balance"] != lsp.CIKMethod || kinds["Billing"] != lsp.CIKModule || kinds["Ledger"] != 0 {
+		t.Errorf("unexpected identifier items: %v", kinds)
+	}
+}
+
+func TestPublishDiagnosticsBeforeIndexing(t *testing.T) {
+	var published []lsp.PublishDiagnosticsParams
+	h := New(log.New(io.Discard, "", 0), func(method string, params any) error {
+		if p, ok := params.(lsp.PublishDiagnosticsParams); ok {
+			published = append(published, p)
+		}
+		return nil
+	})
+	h.parser = sitter.NewParser()
+	h.parser.SetLanguage(ruby.GetLanguage())
+	h.workspace = index.NewWorkspace(t.TempDir())
+	start := time.Now()
+	err := h.DidOpenHandler([]byte(`{"textDocument": {"uri": "file:///app/report.rb", "text": "class Report\n  def total(\nend\n"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("publishing waited for the index")
+	}
+	if len(published) != 1 || len(published[0].Diagnostics) == 0 || published[0].Diagnostics[0].Severity != lsp.Error {
+		t.Errorf("unexpected diagnostics: %+v", published)
+	}
+}
+
+func TestRenderGenerator(t *testing.T) {
+	at := &index.Location{FileURI: "/app/models/point.rb", Line: 2}
+	m := &index.MethodDecl{Name: "x", Owner: "Point", Signature: "Struct.new(:x, :y)", Generator: &index.Range{Start: at, End: at}}
+	if got := renderNode(m); !strings.Contains(got, "Generated at [point.rb:3](file:///app/models/point.rb#L3)") {
+		t.Errorf("generator not rendered: %s", got)
+	}
+	m.Generator = nil
+	if got := renderNode(m); strings.Contains(got, "Generated") {
+		t.Errorf("declared method rendered as generated: %s", got)
+	}
+}
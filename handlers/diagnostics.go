@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+func uriToPath(uri lsp.DocumentURI) string {
+	u, err := url.Parse(string(uri))
+	if err != nil || u.Scheme != "file" {
+		return string(uri)
+	}
+	return u.Path
+}
+
+func pathToURI(path string) lsp.DocumentURI {
+	return lsp.DocumentURI((&url.URL{Scheme: "file", Path: path}).String())
+}
+
+// fileDiagnostics returns the problems the index knows about in the file
+// at path.
+func fileDiagnostics(idx *index.Index, path string) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	if m, ok := idx.CheckAutoload(path); ok {
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Severity: lsp.Warning,
+			Source:   "ruby-lsp",
+			Message: fmt.Sprintf("expected file to define %s, but it defines %s",
+				m.Expected, strings.Join(m.Defined, ", ")),
+		})
+	}
+	for _, p := range idx.Problems {
+		if p.Path != path {
+			continue
+		}
+		severity, message := lsp.Error, "file could not be indexed: "+p.Message
+		if p.Partial {
+			severity, message = lsp.Warning, "file was only partially indexed: "+p.Message
+		}
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: p.Line},
+				End:   lsp.Position{Line: p.Line},
+			},
+			Severity: severity,
+			Source:   "ruby-lsp",
+			Message:  message,
+		})
+	}
+	return diagnostics
+}
+
+// syntaxDiagnostics returns the syntax errors in doc, which need no index.
+func syntaxDiagnostics(doc *TextDocument) []lsp.Diagnostic {
+	var diagnostics []lsp.Diagnostic
+	var visit func(n *sitter.Node)
+	visit = func(n *sitter.Node) {
+		if !n.HasError() {
+			return
+		}
+		if n.IsError() || n.IsMissing() {
+			message := "syntax error"
+			if n.IsMissing() {
+				message = "missing " + n.Type()
+			}
+			diagnostics = append(diagnostics, lsp.Diagnostic{
+				Range:    lsp.Range{Start: doc.position(n.StartPoint()), End: doc.position(n.EndPoint())},
+				Severity: lsp.Error,
+				Source:   "ruby-lsp",
+				Message:  message,
+			})
+			return
+		}
+		for k := 0; k < int(n.ChildCount()); k++ {
+			visit(n.Child(k))
+		}
+	}
+	visit(doc.tree.RootNode())
+	return diagnostics
+}
+
+// publishDiagnostics publishes the syntax errors of the document at uri
+// and, once the workspace has been indexed, the problems the index knows
+// about. It does not wait for the index, which republishes them when it
+// is published.
+func (h *Handler) publishDiagnostics(uri lsp.DocumentURI) error {
+	if h.notify == nil {
+		return nil
+	}
+	diagnostics := []lsp.Diagnostic{}
+	if doc, ok := h.document(uri); ok {
+		diagnostics = append(diagnostics, syntaxDiagnostics(doc)...)
+	}
+	if h.workspace != nil {
+		if idx, err := h.workspace.Snapshot(0); err == nil {
+			diagnostics = append(diagnostics, fileDiagnostics(idx, uriToPath(uri))...)
+		}
+	}
+	return h.notify("textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// indexed reports the files a new snapshot failed to index, clears the
+// diagnostics of files that were fixed since the previous one, and logs a
+// summary to the client.
+func (h *Handler) indexed(idx *index.Index) {
+	if h.notify == nil {
+		return
+	}
+	reported := make(map[lsp.DocumentURI]bool)
+	for _, p := range idx.Problems {
+		reported[pathToURI(p.Path)] = true
+	}
+	for uri := range h.reported {
+		if !reported[uri] {
+			h.publishDiagnostics(uri)
+		}
+	}
+	for uri := range reported {
+		h.publishDiagnostics(uri)
+	}
+	// Open documents were published before this snapshot could check them.
+	h.mu.RLock()
+	var open []lsp.DocumentURI
+	for uri := range h.files {
+		if !reported[lsp.DocumentURI(uri)] && !h.reported[lsp.DocumentURI(uri)] {
+			open = append(open, lsp.DocumentURI(uri))
+		}
+	}
+	h.mu.RUnlock()
+	for _, uri := range open {
+		h.publishDiagnostics(uri)
+	}
+	h.reported = reported
+	h.notify("window/logMessage", lsp.LogMessageParams{
+		Type:    lsp.Info,
+		Message: fmt.Sprintf("ruby-lsp: indexed %d files, %d could not be fully indexed", idx.FileCount(), len(reported)),
+	})
+}
@@ -13,15 +13,15 @@ func (h *Handler) DidOpenHandler(params json.RawMessage) error {
 	if err := json.Unmarshal(params, &paramsData); err != nil {
 		return err
 	}
+	h.mu.Lock()
 	tree, err := h.parser.ParseCtx(context.Background(), nil, []byte(paramsData.TextDocument.Text))
 	if err != nil {
+		h.mu.Unlock()
 		return err
 	}
-	h.files[string(paramsData.TextDocument.URI)] = &TextDocument{
-		content: []byte(paramsData.TextDocument.Text),
-		tree:    tree,
-	}
-	return nil
+	h.files[string(paramsData.TextDocument.URI)] = newTextDocument(uriToPath(paramsData.TextDocument.URI), []byte(paramsData.TextDocument.Text), tree)
+	h.mu.Unlock()
+	return h.publishDiagnostics(paramsData.TextDocument.URI)
 }
 
 func (h *Handler) DidChangeHandler(params json.RawMessage) error {
@@ -29,16 +29,31 @@ func (h *Handler) DidChangeHandler(params json.RawMessage) error {
 	if err := json.Unmarshal(params, &paramsData); err != nil {
 		return err
 	}
+	h.mu.Lock()
 	doc, ok := h.files[string(paramsData.TextDocument.URI)]
 	if !ok {
+		h.mu.Unlock()
 		return errors.New("file never opened")
 	}
-	doc.content = []byte(paramsData.ContentChanges[0].Text)
-
-	var err error
-	doc.tree, err = h.parser.ParseCtx(context.Background(), doc.tree, doc.content)
+	content := []byte(paramsData.ContentChanges[0].Text)
+	tree, err := h.parser.ParseCtx(context.Background(), doc.tree, content)
 	if err != nil {
+		h.mu.Unlock()
 		return err
 	}
+	h.files[string(paramsData.TextDocument.URI)] = newTextDocument(doc.path, content, tree)
+	h.mu.Unlock()
+	// Syntax errors follow the edits.
+	return h.publishDiagnostics(paramsData.TextDocument.URI)
+}
+
+// DidChangeWatchedFilesHandler rebuilds the index in the background when
+// files change on disk. Requests keep using the previous snapshot until
+// the new one is published.
+func (h *Handler) DidChangeWatchedFilesHandler(params json.RawMessage) error {
+	if h.workspace == nil {
+		return nil
+	}
+	go h.workspace.Index(h.logger)
 	return nil
 }
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+type DocumentSymbolParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+}
+
+// DocumentSymbol is the hierarchical document symbol of LSP 3.10, which
+// go-lsp does not model.
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           lsp.SymbolKind   `json:"kind"`
+	Range          lsp.Range        `json:"range"`
+	SelectionRange lsp.Range        `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+var symbolKinds = map[index.SymbolKind]lsp.SymbolKind{
+	index.SymbolModule:       lsp.SKModule,
+	index.SymbolClass:        lsp.SKClass,
+	index.SymbolMethod:       lsp.SKMethod,
+	index.SymbolConstant:     lsp.SKConstant,
+	index.SymbolExampleGroup: lsp.SKNamespace,
+	index.SymbolExample:      lsp.SKMethod,
+	index.SymbolLet:          lsp.SKVariable,
+	index.SymbolHook:         lsp.SKEvent,
+	index.SymbolSharedGroup:  lsp.SKInterface,
+	index.SymbolNamespace:    lsp.SKNamespace,
+	index.SymbolTask:         lsp.SKFunction,
+}
+
+func (h *Handler) DocumentSymbols(params json.RawMessage) (any, error) {
+	var symbolParams DocumentSymbolParams
+	if err := json.Unmarshal(params, &symbolParams); err != nil {
+		return nil, err
+	}
+	doc, ok := h.document(symbolParams.TextDocument.URI)
+	if !ok {
+		return nil, errors.New("unopened file")
+	}
+	return doc.documentSymbols(doc.symbols()), nil
+}
+
+func (d *TextDocument) documentSymbols(symbols []*index.Symbol) []DocumentSymbol {
+	res := []DocumentSymbol{}
+	for _, s := range symbols {
+		res = append(res, DocumentSymbol{
+			Name:           s.Name,
+			Detail:         s.Detail,
+			Kind:           symbolKinds[s.Kind],
+			Range:          d.rangeOf(s.Start, s.End),
+			SelectionRange: d.rangeOf(s.NameStart, s.NameEnd),
+			Children:       d.documentSymbols(s.Children),
+		})
+	}
+	return res
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	lsp "github.com/sourcegraph/go-lsp"
+)
+
+type ExplainFileResult struct {
+	Indexed bool   `json:"indexed"`
+	Reason  string `json:"reason"`
+}
+
+// ExplainFile handles ruby/explainFile, which tells the client whether a
+// file is part of the index and, if not, which setting or ignore rule
+// left it out.
+func (h *Handler) ExplainFile(params json.RawMessage) (any, error) {
+	var explainParams lsp.TextDocumentIdentifier
+	if err := json.Unmarshal(params, &explainParams); err != nil {
+		return nil, err
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	indexed, reason := idx.ExplainFile(uriToPath(explainParams.URI))
+	return ExplainFileResult{Indexed: indexed, Reason: reason}, nil
+}
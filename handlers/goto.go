@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 
 	sitter "github.com/smacker/go-tree-sitter"
 	"github.com/sourcegraph/go-lsp"
@@ -26,37 +27,97 @@ func (h *Handler) GoToDef(params json.RawMessage) (any, error) {
 	if err := json.Unmarshal(params, &defParams); err != nil {
 		return nil, err
 	}
-	point := sitter.Point{
-		Row:    uint32(defParams.Position.Line),
-		Column: uint32(defParams.Position.Character),
-	}
-	doc, ok := h.files[string(defParams.TextDocument.URI)]
+	doc, ok := h.document(defParams.TextDocument.URI)
 	if !ok {
 		return nil, errors.New("unopened file")
 	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	point := doc.point(defParams.Position)
 	selected := doc.tree.RootNode().NamedDescendantForPointRange(point, point)
 	if selected == nil {
 		return nil, errors.New("failed")
 	}
 	var ranges []*index.Range
 	switch selected.Type() {
+	case "string_content":
+		if loc, ok := requireTarget(idx, doc, defParams.Position); ok {
+			return []lsp.Location{loc}, nil
+		}
+		name := selected.Content(doc.content)
+		if ranges, ok = idx.LookupSharedGroup(name); ok {
+			break
+		}
+		if !isTaskName(doc, selected, defParams.TextDocument.URI) {
+			return nil, errors.New("no ranges found")
+		}
+		ranges, ok = idx.LookupTask(name, index.RakeNamespaceAt(doc.symbols(), doc.offset(defParams.Position)))
+		if !ok {
+			return nil, errors.New("no ranges found")
+		}
+	case "simple_symbol":
+		// Symbols name Rake prerequisites and the methods of callbacks.
+		name := strings.TrimPrefix(selected.Content(doc.content), ":")
+		if isTaskName(doc, selected, defParams.TextDocument.URI) {
+			if ranges, ok = idx.LookupTask(name, index.RakeNamespaceAt(doc.symbols(), doc.offset(defParams.Position))); ok {
+				break
+			}
+		}
+		ranges, ok = idx.LookupIdentifier(name)
+		if !ok {
+			return nil, errors.New("no ranges found")
+		}
 	case "constant":
-		ranges, ok = h.index.LookupConstant(selected.Content(doc.content))
+		path := constantPath(selected, doc.content)
+		if _, nodes, resolved := idx.ResolveConstant(path, lexicalNesting(selected, doc.content)); resolved {
+			for _, n := range nodes {
+				ranges = append(ranges, n.Range())
+			}
+			break
+		}
+		ranges, ok = idx.LookupConstant(selected.Content(doc.content))
 		if !ok {
 			return nil, errors.New("no ranges found")
 		}
 	case "identifier":
+		name := selected.Content(doc.content)
+		if l := doc.localAt(name, defParams.Position); l != nil {
+			return []lsp.Location{{URI: defParams.TextDocument.URI, Range: doc.rangeOf(l.Start, l.End)}}, nil
+		}
+		if let := index.LetAt(doc.symbols(), name, doc.offset(defParams.Position)); let != nil {
+			return []lsp.Location{{URI: defParams.TextDocument.URI, Range: doc.rangeOf(let.NameStart, let.NameEnd)}}, nil
+		}
+		if methods := methodsOn(idx, receiverTypes(idx, doc, selected), name); len(methods) > 0 {
+			for _, m := range methods {
+				ranges = append(ranges, m.Range())
+			}
+			break
+		}
 		h.logger.Println("identifier lookup started")
-		ranges, ok = h.index.LookupIdentifier(selected.Content(doc.content))
+		ranges, ok = idx.LookupIdentifier(selected.Content(doc.content))
 		h.logger.Println("identifier lookup finished")
 		if !ok {
 			h.logger.Println("identifier lookup errored")
 			return nil, errors.New("no ranges found")
 		}
+	case "instance_variable", "class_variable":
+		namespace, singleton := enclosingScope(selected, doc.content)
+		for _, v := range idx.Variables(namespace, selected.Content(doc.content), singleton) {
+			ranges = append(ranges, v.Range())
+		}
+		if len(ranges) == 0 {
+			return nil, errors.New("no ranges found")
+		}
 	default:
 		h.logger.Printf("unknown node type %s", selected.Type())
 		return nil, errors.New("unknown node")
 	}
+	// Bundled core declarations have no file to open.
+	ranges = filter(ranges, func(r *index.Range) bool {
+		return r.End.FileURI != index.CorePath
+	})
 	return Map(ranges, func(r *index.Range) lsp.Location {
 		return lsp.Location{
 			URI: lsp.DocumentURI(r.End.FileURI),
@@ -73,3 +134,38 @@ func (h *Handler) GoToDef(params json.RawMessage) (any, error) {
 		}
 	}), nil
 }
+
+// isTaskName reports whether the symbol or string n may name a Rake task:
+// anywhere in a Rake file, elsewhere only as the prerequisite of a task.
+func isTaskName(doc *TextDocument, n *sitter.Node, uri lsp.DocumentURI) bool {
+	if index.IsRakeFile(uriToPath(uri)) {
+		return true
+	}
+	value := n
+	if value.Type() == "string_content" {
+		value = value.Parent()
+	}
+	if value.Parent() != nil && value.Parent().Type() == "array" {
+		value = value.Parent()
+	}
+	pair := value.Parent()
+	if pair == nil || pair.Type() != "pair" || !value.Equal(pair.ChildByFieldName("value")) {
+		return false
+	}
+	args := pair.Parent()
+	if args != nil && args.Type() == "hash" {
+		args = args.Parent()
+	}
+	if args == nil || args.Type() != "argument_list" || args.Parent() == nil {
+		return false
+	}
+	call := args.Parent()
+	if call.Type() != "call" || call.ChildByFieldName("receiver") != nil {
+		return false
+	}
+	switch call.ChildByFieldName("method").Content(doc.content) {
+	case "task", "multitask", "file", "directory", "rule":
+		return true
+	}
+	return false
+}
@@ -2,27 +2,167 @@ package handlers
 
 import (
 	"log"
+	"sync"
+	"time"
 
 	sitter "github.com/smacker/go-tree-sitter"
+	lsp "github.com/sourcegraph/go-lsp"
 	"github.com/tjgurwara99/ruby-lsp/code/index"
 )
 
+// indexTimeout bounds how long a request made during startup waits for
+// the first index snapshot.
+const indexTimeout = 10 * time.Second
+
+// TextDocument is an open file. Edits replace it rather than modify it, so
+// requests can keep using the version they started with.
 type TextDocument struct {
+	path    string
 	tree    *sitter.Tree
 	content []byte
+	lines   *index.LineIndex
+
+	localsOnce sync.Once
+	scope      *index.LocalScope
+
+	symbolsOnce sync.Once
+	outline     []*index.Symbol
+
+	requiresOnce sync.Once
+	requires     []index.Require
+	requiresErr  error
+
+	// inference is kept for the index snapshot it was made with.
+	inferenceMu  sync.Mutex
+	inferenceIdx *index.Index
+	inference    *index.Inference
+}
+
+func newTextDocument(path string, content []byte, tree *sitter.Tree) *TextDocument {
+	return &TextDocument{
+		path:    path,
+		tree:    tree,
+		content: content,
+		lines:   index.NewLineIndex(content),
+	}
+}
+
+// point converts an LSP position, in UTF-16 code units, to the byte based
+// point tree-sitter uses.
+func (d *TextDocument) point(pos lsp.Position) sitter.Point {
+	return sitter.Point{
+		Row:    uint32(pos.Line),
+		Column: uint32(d.lines.Column(pos.Line, pos.Character)),
+	}
+}
+
+func (d *TextDocument) position(p sitter.Point) lsp.Position {
+	return lsp.Position{
+		Line:      int(p.Row),
+		Character: d.lines.Character(int(p.Row), int(p.Column)),
+	}
+}
+
+// locals returns the local variable scopes of the document, analysed on
+// first use. It is nil when the document cannot be parsed.
+func (d *TextDocument) locals() *index.LocalScope {
+	d.localsOnce.Do(func() {
+		d.scope, _ = index.Locals(d.content)
+	})
+	return d.scope
+}
+
+// symbols returns the outline of the document, built on first use.
+func (d *TextDocument) symbols() []*index.Symbol {
+	d.symbolsOnce.Do(func() {
+		d.outline, _ = index.DocumentSymbols(d.path, d.content)
+	})
+	return d.outline
+}
+
+// typeAt infers the types of the expression ending at offset, parsing the
+// document once per index snapshot.
+func (d *TextDocument) typeAt(idx *index.Index, offset int) []index.Type {
+	d.inferenceMu.Lock()
+	defer d.inferenceMu.Unlock()
+	if d.inferenceIdx != idx {
+		d.inference, d.inferenceIdx = idx.Infer(d.content), idx
+	}
+	return d.inference.TypeAt(offset)
+}
+
+// rangeOf converts a span of byte offsets to an LSP range.
+func (d *TextDocument) rangeOf(start, end int) lsp.Range {
+	startLine, startChar := d.lines.Position(start)
+	endLine, endChar := d.lines.Position(end)
+	return lsp.Range{
+		Start: lsp.Position{Line: startLine, Character: startChar},
+		End:   lsp.Position{Line: endLine, Character: endChar},
+	}
+}
+
+// fileRequires returns the requires in the document, found on first use.
+func (d *TextDocument) fileRequires() ([]index.Require, error) {
+	d.requiresOnce.Do(func() {
+		d.requires, d.requiresErr = index.FileRequires(d.path, d.content)
+	})
+	return d.requires, d.requiresErr
+}
+
+// localAt returns the local named name visible at pos.
+func (d *TextDocument) localAt(name string, pos lsp.Position) *index.LocalVar {
+	if d.locals() == nil {
+		return nil
+	}
+	return d.locals().Lookup(name, d.offset(pos))
+}
+
+// offset returns the byte offset of an LSP position.
+func (d *TextDocument) offset(pos lsp.Position) int {
+	return d.lines.Offset(pos.Line, pos.Character)
 }
 
 type Handler struct {
-	logger   *log.Logger
-	language *sitter.Language
-	parser   *sitter.Parser
-	files    map[string]*TextDocument
-	index    *index.Index
+	logger    *log.Logger
+	language  *sitter.Language
+	parser    *sitter.Parser
+	workspace *index.Workspace
+	notify    func(method string, params any) error
+	// snippets is whether the client accepts snippet completions.
+	snippets        bool
+	completionLimit int
+	history         completionHistory
+	// reported holds the files with index problems in the last snapshot,
+	// whose diagnostics are cleared once they index cleanly.
+	reported map[lsp.DocumentURI]bool
+
+	// mu guards files and the parser, which requests and notifications
+	// use from their own goroutines.
+	mu    sync.RWMutex
+	files map[string]*TextDocument
 }
 
-func New(l *log.Logger) *Handler {
+func New(l *log.Logger, notify func(method string, params any) error) *Handler {
 	return &Handler{
-		logger: l,
-		files:  make(map[string]*TextDocument),
+		logger:          l,
+		files:           make(map[string]*TextDocument),
+		notify:          notify,
+		completionLimit: defaultCompletionLimit,
+	}
+}
+
+func (h *Handler) document(uri lsp.DocumentURI) (*TextDocument, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	doc, ok := h.files[string(uri)]
+	return doc, ok
+}
+
+// snapshot returns the current index, waiting for the first one while the
+// server is starting up.
+func (h *Handler) snapshot() (*index.Index, error) {
+	if h.workspace == nil {
+		return nil, index.ErrNotIndexed
 	}
+	return h.workspace.Snapshot(indexTimeout)
 }
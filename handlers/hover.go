@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+type MarkupContent struct {
+	/**
+	 * The type of the Markup
+	 */
+	Kind string `json:"kind"`
+
+	/**
+	 * The content itself
+	 */
+	Value string `json:"value"`
+}
+
+type Hover struct {
+	/**
+	 * The hover's content
+	 */
+	Contents MarkupContent `json:"contents"`
+
+	/**
+	 * An optional range is a range inside a text document
+	 * that is used to visualize a hover, e.g. by changing the background color.
+	 */
+	Range *lsp.Range `json:"range,omitempty"`
+}
+
+func (h *Handler) Hover(params json.RawMessage) (any, error) {
+	var hoverParams lsp.TextDocumentPositionParams
+	if err := json.Unmarshal(params, &hoverParams); err != nil {
+		return nil, err
+	}
+	doc, ok := h.document(hoverParams.TextDocument.URI)
+	if !ok {
+		return nil, errors.New("unopened file")
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	point := doc.point(hoverParams.Position)
+	selected := doc.tree.RootNode().NamedDescendantForPointRange(point, point)
+	if selected == nil {
+		return nil, nil
+	}
+	var sections []string
+	switch selected.Type() {
+	case "constant":
+		nodes := idx.Constants(selected.Content(doc.content))
+		if _, resolved, ok := idx.ResolveConstant(constantPath(selected, doc.content), lexicalNesting(selected, doc.content)); ok {
+			nodes = resolved
+		}
+		for _, n := range nodes {
+			sections = append(sections, renderNode(n))
+		}
+	case "identifier":
+		name := selected.Content(doc.content)
+		methods := methodsOn(idx, receiverTypes(idx, doc, selected), name)
+		if len(methods) == 0 {
+			methods = idx.Methods(name)
+		}
+		for _, m := range methods {
+			sections = append(sections, renderNode(m))
+		}
+	}
+	if len(sections) == 0 {
+		return nil, nil
+	}
+	return Hover{
+		Contents: MarkupContent{
+			Kind:  "markdown",
+			Value: strings.Join(sections, "\n\n---\n\n"),
+		},
+		Range: &lsp.Range{
+			Start: doc.position(selected.StartPoint()),
+			End:   doc.position(selected.EndPoint()),
+		},
+	}, nil
+}
+
+func renderNode(n index.Node) string {
+	var title, signature string
+	var doc *index.Doc
+	switch d := n.(type) {
+	case *index.ModuleDecl:
+		signature, doc = "module "+d.FullName(), d.Doc
+	case *index.ClassDecl:
+		signature, doc = "class "+d.FullName(), d.Doc
+		if d.Superclass != "" {
+			signature += " < " + d.Superclass
+		}
+	case *index.ConstantDecl:
+		signature, doc = d.FullName()+" = "+d.Value, d.Doc
+	case *index.MethodDecl:
+		signature, doc = d.Signature, d.Doc
+		if d.Owner != "" {
+			title = "**" + d.FullName() + "**\n\n"
+		}
+		var sigs, types []string
+		for _, t := range d.Types {
+			if t.Sig != "" {
+				sigs = append(sigs, t.Sig)
+			} else {
+				types = append(types, t.Text)
+			}
+		}
+		var blocks []string
+		if code := strings.TrimSpace(strings.Join(append(sigs, signature), "\n")); code != "" {
+			blocks = append(blocks, "```ruby\n"+code+"\n```")
+		}
+		if len(types) > 0 {
+			indent := "\n" + strings.Repeat(" ", len(d.Name)+4) + "| "
+			blocks = append(blocks, "```rbs\ndef "+d.Name+": "+strings.Join(types, indent)+"\n```")
+		}
+		return title + strings.Join(blocks, "\n\n") + generatorMarkdown(d) + docMarkdown(doc)
+	}
+	return title + "```ruby\n" + signature + "\n```" + docMarkdown(doc)
+}
+
+// generatorMarkdown links a synthetic method to the call defining it.
+func generatorMarkdown(m *index.MethodDecl) string {
+	if !m.Synthetic() || m.Generator.Start == nil {
+		return ""
+	}
+	start := m.Generator.Start
+	return fmt.Sprintf("\n\nGenerated at [%s:%d](%s#L%d)",
+		filepath.Base(start.FileURI), start.Line+1, pathToURI(start.FileURI), start.Line+1)
+}
+
+func docMarkdown(doc *index.Doc) string {
+	if md := doc.Markdown(); md != "" {
+		return "\n\n" + md
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	lsp "github.com/sourcegraph/go-lsp"
+)
+
+type IndexProblem struct {
+	URI     lsp.DocumentURI `json:"uri"`
+	Line    int             `json:"line"`
+	Message string          `json:"message"`
+	Partial bool            `json:"partial"`
+}
+
+type IndexStatus struct {
+	Ready      bool           `json:"ready"`
+	Generation int            `json:"generation"`
+	Files      int            `json:"files"`
+	Problems   []IndexProblem `json:"problems"`
+}
+
+// IndexStatus handles ruby/indexStatus. It does not wait for the first
+// snapshot: a client polling during startup sees ready false.
+func (h *Handler) IndexStatus(params json.RawMessage) (any, error) {
+	if h.workspace == nil {
+		return IndexStatus{}, nil
+	}
+	idx, err := h.workspace.Snapshot(0)
+	if err != nil {
+		return IndexStatus{}, nil
+	}
+	status := IndexStatus{
+		Ready:      true,
+		Generation: idx.Generation,
+		Files:      idx.FileCount(),
+		Problems:   []IndexProblem{},
+	}
+	for _, p := range idx.Problems {
+		status.Problems = append(status.Problems, IndexProblem{
+			URI:     pathToURI(p.Path),
+			Line:    p.Line,
+			Message: p.Message,
+			Partial: p.Partial,
+		})
+	}
+	return status, nil
+}
@@ -11,6 +11,20 @@ import (
 
 var TextDocumentSyncKindFull = lsp.TDSKFull
 
+type DocumentLinkOptions struct {
+	ResolveProvider bool `json:"resolveProvider,omitempty"`
+}
+
+// ServerCapabilities adds the capabilities go-lsp does not model.
+type ServerCapabilities struct {
+	lsp.ServerCapabilities
+	DocumentLinkProvider *DocumentLinkOptions `json:"documentLinkProvider,omitempty"`
+}
+
+type InitializeResult struct {
+	Capabilities ServerCapabilities `json:"capabilities"`
+}
+
 func (h *Handler) Initialize(params json.RawMessage) (any, error) {
 	var initializeParams lsp.InitializeParams
 	if err := json.Unmarshal(params, &initializeParams); err != nil {
@@ -20,15 +34,41 @@ func (h *Handler) Initialize(params json.RawMessage) (any, error) {
 	h.parser = sitter.NewParser()
 	h.parser.SetLanguage(h.language)
 	h.logger.Printf("root path: %s\n", initializeParams.RootPath)
-	h.index = index.New(initializeParams.RootPath)
-	go h.index.Start(h.logger)
-	result := lsp.InitializeResult{
-		Capabilities: lsp.ServerCapabilities{
-			TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
-				Kind: &TextDocumentSyncKindFull,
+	settings := parseSettings(initializeParams.InitializationOptions)
+	h.snippets = initializeParams.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport
+	if settings.CompletionLimit > 0 {
+		h.completionLimit = settings.CompletionLimit
+	}
+	h.workspace = index.NewWorkspace(initializeParams.RootPath)
+	h.workspace.Builtins = index.Core()
+	h.workspace.AutoloadRoots = settings.AutoloadPaths
+	h.workspace.Include = settings.Include
+	h.workspace.Exclude = settings.Exclude
+	h.workspace.OnIndexed = h.indexed
+	go h.workspace.Index(h.logger)
+	result := InitializeResult{
+		Capabilities: ServerCapabilities{
+			ServerCapabilities: lsp.ServerCapabilities{
+				TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
+					Kind: &TextDocumentSyncKindFull,
+				},
+				CompletionProvider: &lsp.CompletionOptions{
+					ResolveProvider:   true,
+					TriggerCharacters: []string{".", ":"},
+				},
+				DefinitionProvider:      true,
+				HoverProvider:           true,
+				ReferencesProvider:      true,
+				DocumentSymbolProvider:  true,
+				WorkspaceSymbolProvider: true,
+				ExecuteCommandProvider: &lsp.ExecuteCommandOptions{
+					Commands: []string{completionAccepted},
+				},
+				SignatureHelpProvider: &lsp.SignatureHelpOptions{
+					TriggerCharacters: []string{"(", ","},
+				},
 			},
-			CompletionProvider: &lsp.CompletionOptions{},
-			DefinitionProvider: true,
+			DocumentLinkProvider: &DocumentLinkOptions{},
 		},
 	}
 	return result, nil
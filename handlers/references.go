@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+func (h *Handler) References(params json.RawMessage) (any, error) {
+	var refParams lsp.ReferenceParams
+	if err := json.Unmarshal(params, &refParams); err != nil {
+		return nil, err
+	}
+	doc, ok := h.document(refParams.TextDocument.URI)
+	if !ok {
+		return nil, errors.New("unopened file")
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	point := doc.point(refParams.Position)
+	selected := doc.tree.RootNode().NamedDescendantForPointRange(point, point)
+	if selected == nil {
+		return nil, nil
+	}
+	var refs []*index.Reference
+	var decls []*index.Range
+	switch selected.Type() {
+	case "constant":
+		path, nesting := constantPath(selected, doc.content), lexicalNesting(selected, doc.content)
+		refs = idx.ConstantReferencesTo(path, nesting)
+		if _, nodes, ok := idx.ResolveConstant(path, nesting); ok {
+			for _, n := range nodes {
+				decls = append(decls, n.Range())
+			}
+		}
+	case "identifier":
+		name := selected.Content(doc.content)
+		if doc.localAt(name, refParams.Position) != nil {
+			return []lsp.Location{}, nil
+		}
+		methods := targetMethods(idx, doc, selected, name)
+		refs = idx.MethodReferencesTo(name, methods)
+		for _, m := range methods {
+			decls = append(decls, m.Range())
+		}
+	case "simple_symbol":
+		name := strings.TrimPrefix(selected.Content(doc.content), ":")
+		namespace, _ := enclosingScope(selected, doc.content)
+		methods := nearestMethods(idx, []index.Type{{Name: objectName(namespace)}}, name)
+		refs = idx.MethodReferencesTo(name, methods)
+		for _, m := range methods {
+			decls = append(decls, m.Range())
+		}
+	case "string_content":
+		name := selected.Content(doc.content)
+		refs = idx.ReferencesTo(name, index.RefSharedGroup)
+		decls, _ = idx.LookupSharedGroup(name)
+	default:
+		return nil, nil
+	}
+	locations := []lsp.Location{}
+	for _, ref := range refs {
+		locations = append(locations, location(ref.Range()))
+	}
+	if refParams.Context.IncludeDeclaration {
+		for _, r := range decls {
+			// Only declarations in the workspace can be referenced from it.
+			if r != nil && inRoot(idx.Root, r.Start.FileURI) {
+				locations = append(locations, location(r))
+			}
+		}
+	}
+	return locations, nil
+}
+
+// targetMethods returns the methods the identifier n names: the one it
+// declares, the ones its receiver responds to, or the one self responds to
+// where it is called without a receiver. Every method called name is
+// returned when the receiver cannot be typed.
+func targetMethods(idx *index.Index, doc *TextDocument, n *sitter.Node, name string) []*index.MethodDecl {
+	namespace, singleton := enclosingScope(n, doc.content)
+	self := []index.Type{{Name: objectName(namespace), Singleton: singleton}}
+	p := n.Parent()
+	switch {
+	case p == nil:
+	case p.Type() == "method" || p.Type() == "singleton_method":
+		if decl := p.ChildByFieldName("name"); decl != nil && decl.StartByte() == n.StartByte() {
+			return nearestMethods(idx, self, name)
+		}
+	case p.Type() == "call" && p.ChildByFieldName("receiver") != nil:
+		if receiver := p.ChildByFieldName("receiver"); receiver.Type() != "self" {
+			if methods := nearestMethods(idx, receiverTypes(idx, doc, n), name); len(methods) > 0 {
+				return methods
+			}
+			return idx.Methods(name)
+		}
+	}
+	if methods := nearestMethods(idx, self, name); len(methods) > 0 {
+		return methods
+	}
+	return idx.Methods(name)
+}
+
+// nearestMethods returns, for each type, the method called name that its
+// instances respond to, without the ones it overrides.
+func nearestMethods(idx *index.Index, types []index.Type, name string) []*index.MethodDecl {
+	var res []*index.MethodDecl
+	for _, t := range types {
+		if methods := idx.MethodsFor(t, name); len(methods) > 0 && !slices.Contains(res, methods[0]) {
+			res = append(res, methods[0])
+		}
+	}
+	return res
+}
+
+// objectName returns the class self is an instance of in namespace, Object
+// at the top level.
+func objectName(namespace string) string {
+	if namespace == "" {
+		return "Object"
+	}
+	return namespace
+}
+
+func location(r *index.Range) lsp.Location {
+	return lsp.Location{
+		URI: pathToURI(r.Start.FileURI),
+		Range: lsp.Range{
+			Start: lsp.Position{Line: r.Start.Line, Character: r.Start.Character},
+			End:   lsp.Position{Line: r.End.Line, Character: r.End.Character},
+		},
+	}
+}
+
+// inRoot reports whether path lies in the directory root.
+func inRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+type DocumentLinkParams struct {
+	TextDocument lsp.TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentLink struct {
+	Range   lsp.Range       `json:"range"`
+	Target  lsp.DocumentURI `json:"target,omitempty"`
+	Tooltip string          `json:"tooltip,omitempty"`
+}
+
+// DocumentLinks links the paths of the resolvable requires in a document
+// to the files they load.
+func (h *Handler) DocumentLinks(params json.RawMessage) (any, error) {
+	var linkParams DocumentLinkParams
+	if err := json.Unmarshal(params, &linkParams); err != nil {
+		return nil, err
+	}
+	doc, ok := h.document(linkParams.TextDocument.URI)
+	if !ok {
+		return nil, errors.New("unopened file")
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	requires, err := doc.fileRequires()
+	if err != nil {
+		return nil, err
+	}
+	links := []DocumentLink{}
+	for k := range requires {
+		target, ok := idx.ResolveRequire(&requires[k])
+		if !ok {
+			continue
+		}
+		links = append(links, DocumentLink{
+			Range:   location(requires[k].Range()).Range,
+			Target:  pathToURI(target),
+			Tooltip: target,
+		})
+	}
+	return links, nil
+}
+
+// requireTarget returns the file loaded by the require whose path is at
+// pos.
+func requireTarget(idx *index.Index, doc *TextDocument, pos lsp.Position) (lsp.Location, bool) {
+	requires, err := doc.fileRequires()
+	if err != nil {
+		return lsp.Location{}, false
+	}
+	for k := range requires {
+		r := requires[k].Range()
+		if !contains(r, pos) {
+			continue
+		}
+		target, ok := idx.ResolveRequire(&requires[k])
+		if !ok {
+			return lsp.Location{}, false
+		}
+		return lsp.Location{URI: pathToURI(target)}, true
+	}
+	return lsp.Location{}, false
+}
+
+func contains(r *index.Range, pos lsp.Position) bool {
+	after := pos.Line > r.Start.Line || pos.Line == r.Start.Line && pos.Character >= r.Start.Character
+	before := pos.Line < r.End.Line || pos.Line == r.End.Line && pos.Character <= r.End.Character
+	return after && before
+}
+
+type DependencyGraphParams struct {
+	// TextDocument restricts the graph to the edges from and to a file.
+	TextDocument *lsp.TextDocumentIdentifier `json:"textDocument,omitempty"`
+}
+
+type DependencyEdge struct {
+	From lsp.DocumentURI `json:"from"`
+	// To is omitted when the required file could not be found.
+	To      lsp.DocumentURI `json:"to,omitempty"`
+	Method  string          `json:"method"`
+	Require string          `json:"require"`
+	Range   lsp.Range       `json:"range"`
+}
+
+// DependencyGraph handles ruby/dependencyGraph, returning the require
+// edges between workspace files.
+func (h *Handler) DependencyGraph(params json.RawMessage) (any, error) {
+	var graphParams DependencyGraphParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &graphParams); err != nil {
+			return nil, err
+		}
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	var file string
+	if graphParams.TextDocument != nil {
+		file = uriToPath(graphParams.TextDocument.URI)
+	}
+	edges := []DependencyEdge{}
+	for _, d := range idx.DependencyGraph() {
+		if file != "" && d.From != file && d.To != file {
+			continue
+		}
+		edge := DependencyEdge{
+			From:    pathToURI(d.From),
+			Method:  d.Require.Method,
+			Require: d.Require.Path,
+			Range:   location(d.Require.Range()).Range,
+		}
+		if d.To != "" {
+			edge.To = pathToURI(d.To)
+		}
+		edges = append(edges, edge)
+	}
+	return edges, nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// enclosingScope returns the fully qualified name of the class or module
+// n appears in, and whether self there is the class object itself.
+func enclosingScope(n *sitter.Node, src []byte) (namespace string, singleton bool) {
+	inMethod, decided := false, false
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		switch p.Type() {
+		case "method":
+			inMethod = true
+		case "singleton_method":
+			if !decided {
+				singleton, decided = true, true
+			}
+		case "singleton_class":
+			singleton, decided = true, true
+		case "class", "module":
+			if !decided {
+				singleton, decided = !inMethod, true
+			}
+			name := p.ChildByFieldName("name")
+			if name == nil {
+				continue
+			}
+			if namespace == "" {
+				namespace = name.Content(src)
+			} else {
+				namespace = name.Content(src) + "::" + namespace
+			}
+			// A class declared through ::Name is top-level wherever it is.
+			if strings.HasPrefix(namespace, "::") {
+				return strings.TrimPrefix(namespace, "::"), singleton
+			}
+		}
+	}
+	return namespace, singleton
+}
+
+// lexicalNesting returns the fully qualified names of the classes and
+// modules n is lexically inside, innermost first like Module.nesting. The
+// name and superclass of a class are evaluated outside of it.
+func lexicalNesting(n *sitter.Node, src []byte) []string {
+	var names []string
+	child := n
+	for p := n.Parent(); p != nil; child, p = p, p.Parent() {
+		if p.Type() != "class" && p.Type() != "module" {
+			continue
+		}
+		name := p.ChildByFieldName("name")
+		if name == nil || within(child, name) || within(child, p.ChildByFieldName("superclass")) {
+			continue
+		}
+		names = append(names, name.Content(src))
+	}
+	var nesting []string
+	for k := len(names) - 1; k >= 0; k-- {
+		name := names[k]
+		if strings.HasPrefix(name, "::") {
+			name = strings.TrimPrefix(name, "::")
+		} else if len(nesting) > 0 {
+			name = nesting[0] + "::" + name
+		}
+		nesting = append([]string{name}, nesting...)
+	}
+	return nesting
+}
+
+func within(n, outer *sitter.Node) bool {
+	return outer != nil && n.StartByte() >= outer.StartByte() && n.EndByte() <= outer.EndByte()
+}
+
+// constantPath returns the scoped constant path a constant node is the
+// last segment of, such as Foo::Bar for Bar in Foo::Bar::Baz.
+func constantPath(n *sitter.Node, src []byte) string {
+	path := n
+	if p := n.Parent(); p != nil && p.Type() == "scope_resolution" {
+		if name := p.ChildByFieldName("name"); name != nil && name.StartByte() == n.StartByte() {
+			path = p
+		}
+	}
+	return path.Content(src)
+}
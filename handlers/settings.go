@@ -0,0 +1,30 @@
+package handlers
+
+import "encoding/json"
+
+// Settings are the server options clients pass as initializationOptions.
+type Settings struct {
+	// AutoloadPaths replaces the Rails autoload roots, relative to the
+	// workspace root.
+	AutoloadPaths []string `json:"autoloadPaths"`
+	// Include and Exclude are glob patterns, relative to the workspace
+	// root, selecting the files to index.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// CompletionLimit caps the number of completion items returned,
+	// defaultCompletionLimit when unset.
+	CompletionLimit int `json:"completionLimit"`
+}
+
+func parseSettings(options any) Settings {
+	var settings Settings
+	if options == nil {
+		return settings
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return settings
+	}
+	json.Unmarshal(data, &settings)
+	return settings
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+func (h *Handler) SignatureHelp(params json.RawMessage) (any, error) {
+	var helpParams lsp.TextDocumentPositionParams
+	if err := json.Unmarshal(params, &helpParams); err != nil {
+		return nil, err
+	}
+	doc, ok := h.document(helpParams.TextDocument.URI)
+	if !ok {
+		return nil, errors.New("unopened file")
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	point := doc.point(helpParams.Position)
+	node := doc.tree.RootNode().NamedDescendantForPointRange(point, point)
+	for node != nil && !(node.Type() == "argument_list" && node.Parent() != nil && node.Parent().Type() == "call") {
+		node = node.Parent()
+	}
+	if node == nil {
+		return nil, nil
+	}
+	method := node.Parent().ChildByFieldName("method")
+	if method == nil {
+		return nil, nil
+	}
+	active := 0
+	for k := 0; k < int(node.ChildCount()); k++ {
+		child := node.Child(k)
+		if child.Type() == "," && pointBefore(child.StartPoint(), point) {
+			active++
+		}
+	}
+	var signatures []lsp.SignatureInformation
+	for _, m := range idx.Methods(method.Content(doc.content)) {
+		signatures = append(signatures, signatureInformation(m)...)
+	}
+	if len(signatures) == 0 {
+		return nil, nil
+	}
+	return lsp.SignatureHelp{
+		Signatures:      signatures,
+		ActiveParameter: active,
+	}, nil
+}
+
+func pointBefore(a, b sitter.Point) bool {
+	return a.Row < b.Row || (a.Row == b.Row && a.Column < b.Column)
+}
+
+func signatureInformation(m *index.MethodDecl) []lsp.SignatureInformation {
+	var documentation string
+	if m.Doc != nil {
+		documentation = m.Doc.Text
+	}
+	if len(m.Types) == 0 {
+		label := strings.TrimPrefix(m.Signature, "def ")
+		if !strings.Contains(label, "(") {
+			label = m.Name + "(" + strings.Join(m.Args, ", ") + ")"
+		}
+		return []lsp.SignatureInformation{{
+			Label:         label,
+			Documentation: documentation,
+			Parameters: Map(m.Args, func(a string) lsp.ParameterInformation {
+				return lsp.ParameterInformation{Label: a}
+			}),
+		}}
+	}
+	return Map(m.Types, func(t index.MethodType) lsp.SignatureInformation {
+		var params []index.TypedParam
+		for _, p := range t.Params {
+			if p.Kind != index.ParamBlock {
+				params = append(params, p)
+			}
+		}
+		labels := Map(params, func(p index.TypedParam) string {
+			return p.Label()
+		})
+		label := m.Name + "(" + strings.Join(labels, ", ") + ")"
+		if t.Return != "" {
+			label += " -> " + t.Return
+		}
+		return lsp.SignatureInformation{
+			Label:         label,
+			Documentation: documentation,
+			Parameters: Map(labels, func(l string) lsp.ParameterInformation {
+				return lsp.ParameterInformation{Label: l}
+			}),
+		}
+	})
+}
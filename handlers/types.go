@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	sitter "github.com/smacker/go-tree-sitter"
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+// TypeAt infers the types of the expression in doc that ends at pos.
+func TypeAt(idx *index.Index, doc *TextDocument, pos lsp.Position) []index.Type {
+	return doc.typeAt(idx, doc.offset(pos))
+}
+
+// receiverTypes infers the types of the receiver of the call n names the
+// method of, or returns nil when n is not such a name or nothing is known.
+func receiverTypes(idx *index.Index, doc *TextDocument, n *sitter.Node) []index.Type {
+	call := n.Parent()
+	if call == nil || call.Type() != "call" {
+		return nil
+	}
+	method, receiver := call.ChildByFieldName("method"), call.ChildByFieldName("receiver")
+	if method == nil || receiver == nil || method.StartByte() != n.StartByte() {
+		return nil
+	}
+	return TypeAt(idx, doc, doc.position(receiver.EndPoint()))
+}
+
+// methodsOn returns the methods called name that receivers of the given
+// types respond to.
+func methodsOn(idx *index.Index, types []index.Type, name string) []*index.MethodDecl {
+	var res []*index.MethodDecl
+	for _, t := range types {
+		res = append(res, idx.MethodsFor(t, name)...)
+	}
+	return res
+}
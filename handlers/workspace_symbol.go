@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	lsp "github.com/sourcegraph/go-lsp"
+	"github.com/tjgurwara99/ruby-lsp/code/index"
+)
+
+// maxWorkspaceSymbols bounds the results of a workspace symbol query,
+// which an empty query would otherwise fill with the whole workspace.
+const maxWorkspaceSymbols = 500
+
+func (h *Handler) WorkspaceSymbols(params json.RawMessage) (any, error) {
+	var symbolParams lsp.WorkspaceSymbolParams
+	if err := json.Unmarshal(params, &symbolParams); err != nil {
+		return nil, err
+	}
+	idx, err := h.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	limit := symbolParams.Limit
+	if limit <= 0 || limit > maxWorkspaceSymbols {
+		limit = maxWorkspaceSymbols
+	}
+	symbols := []lsp.SymbolInformation{}
+	for _, n := range idx.Search(symbolParams.Query, limit) {
+		info := lsp.SymbolInformation{Location: location(n.Range())}
+		switch d := n.(type) {
+		case *index.ModuleDecl:
+			info.Name, info.Kind, info.ContainerName = d.Name, lsp.SKModule, d.Owner
+		case *index.ClassDecl:
+			info.Name, info.Kind, info.ContainerName = d.Name, lsp.SKClass, d.Owner
+		case *index.ConstantDecl:
+			info.Name, info.Kind, info.ContainerName = d.Name, lsp.SKConstant, d.Owner
+		case *index.MethodDecl:
+			info.Name, info.Kind, info.ContainerName = d.Name, lsp.SKMethod, d.Owner
+		case *index.RakeTask:
+			info.Name, info.Kind = d.Name, lsp.SKFunction
+			if d.Description != "" {
+				info.ContainerName = d.Description
+			}
+		}
+		symbols = append(symbols, info)
+	}
+	return symbols, nil
+}
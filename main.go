@@ -11,12 +11,24 @@ import (
 func main() {
 	logger := getLogger("/Users/taj/personal/ruby-lsp/log.txt")
 	mux := rpc.NewMux(os.Stdin, os.Stdout, logger)
-	handler := handlers.New(logger)
+	handler := handlers.New(logger, mux.Notify)
 	mux.HandleMethod("initialize", handler.Initialize)
 	mux.HandleMethod("textDocument/completion", handler.TextCompletion)
+	mux.HandleMethod("completionItem/resolve", handler.ResolveCompletion)
 	mux.HandleMethod("textDocument/definition", handler.GoToDef)
+	mux.HandleMethod("textDocument/hover", handler.Hover)
+	mux.HandleMethod("textDocument/signatureHelp", handler.SignatureHelp)
+	mux.HandleMethod("textDocument/references", handler.References)
+	mux.HandleMethod("textDocument/documentLink", handler.DocumentLinks)
+	mux.HandleMethod("textDocument/documentSymbol", handler.DocumentSymbols)
+	mux.HandleMethod("workspace/symbol", handler.WorkspaceSymbols)
+	mux.HandleMethod("workspace/executeCommand", handler.ExecuteCommand)
+	mux.HandleMethod("ruby/explainFile", handler.ExplainFile)
+	mux.HandleMethod("ruby/indexStatus", handler.IndexStatus)
+	mux.HandleMethod("ruby/dependencyGraph", handler.DependencyGraph)
 	mux.HandleNotification("textDocument/didOpen", handler.DidOpenHandler)
 	mux.HandleNotification("textDocument/didChange", handler.DidChangeHandler)
+	mux.HandleNotification("workspace/didChangeWatchedFiles", handler.DidChangeWatchedFilesHandler)
 	for {
 		if err := mux.Process(); err != nil {
 			logger.Println(err)